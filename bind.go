@@ -0,0 +1,183 @@
+package phx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/cypher"
+)
+
+// Bind fills dst (a pointer to a struct) from multiple sources of the
+// request and validates it. The sources are selected using tags:
+//
+//	type UpdateUser struct {
+//		Id     int64  `path:"id"`
+//		Page   int    `query:"page"`
+//		Tenant string `header:"X-Tenant"`
+//		Theme  string `cookie:"theme"`
+//		Name   string `json:"name" html:"name" valtruc:"required"`
+//	}
+//
+// The body is decoded as JSON (using json tags) if the Content-Type is
+// application/json. Otherwise it is parsed as a form like ParseForm does.
+// Fields tagged path, query, header or cookie are never read from the
+// body (or from the query string merged in the form), so clients cannot
+// set them that way. Then path params, query params, headers and cookies
+// are set. Cookies are decoded with the registered core.Cypher
+// if there is one, so only cookies created by phx are read.
+//
+// Conversion and validation errors are returned together as
+// ValidationErrors. A malformed JSON body returns an HttpError with
+// status 400.
+func (ctx *Context) Bind(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind destination must be a pointer to a struct, got %T", dst)
+	}
+	errs := ValidationErrors{}
+
+	bodyErrs, err := ctx.bindBody(v.Elem())
+	if err != nil {
+		return err
+	}
+	mergeValidationErrors(errs, bodyErrs)
+
+	params := url.Values{}
+	for _, param := range ctx.params {
+		params.Add(param.Key, param.Value)
+	}
+	mergeValidationErrors(errs, ctx.bindSource(v.Elem(), "path", params, nil))
+	mergeValidationErrors(errs, ctx.bindSource(v.Elem(), "query", ctx.Req.URL.Query(), nil))
+	headers := url.Values{}
+	for key, values := range ctx.Req.Header {
+		headers[strings.ToLower(key)] = values
+	}
+	mergeValidationErrors(errs, ctx.bindSource(v.Elem(), "header", headers, strings.ToLower))
+	mergeValidationErrors(errs, ctx.bindSource(v.Elem(), "cookie", ctx.cookieValues(), nil))
+
+	mergeValidationErrors(errs, ctx.Validate(v.Elem().Interface()))
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (ctx *Context) bindBody(dst reflect.Value) (ValidationErrors, error) {
+	if ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+		return nil, nil
+	}
+	contentType := ctx.Req.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		// The body is decoded into a copy, so only the body fields are
+		// taken from it.
+		decoded := reflect.New(dst.Type())
+		decoded.Elem().Set(dst)
+		if err := ctx.ParseJson(decoded.Interface()); err != nil && !errors.Is(err, io.EOF) {
+			return nil, HttpError{
+				Status:  http.StatusBadRequest,
+				Message: "malformed JSON body",
+				Err:     err,
+			}
+		}
+		copyBodyFields(dst, decoded.Elem())
+		return nil, nil
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"),
+		strings.HasPrefix(contentType, "multipart/form-data"):
+		return ctx.ParseForm(dst.Addr().Interface()), nil
+	default:
+		return nil, nil
+	}
+}
+
+// sourceTags are the tags of the fields that Bind reads from the path,
+// query, headers and cookies. Those fields are not part of the body.
+var sourceTags = []string{"path", "query", "header", "cookie"}
+
+func isSourceField(field reflect.StructField) bool {
+	for _, tag := range sourceTags {
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSourceFields(t reflect.Type) bool {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if isSourceField(field) {
+			return true
+		}
+		if field.Type.Kind() == reflect.Struct && hasSourceFields(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBodyFields copies the fields of src to dst, except the ones read
+// from other sources of the request, also inside nested structs.
+func copyBodyFields(dst, src reflect.Value) {
+	t := dst.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if isSourceField(field) {
+			continue
+		}
+		dstField := dst.Field(i)
+		if field.Type.Kind() == reflect.Struct &&
+			(hasSourceFields(field.Type) || (field.Anonymous && !dstField.CanSet())) {
+			copyBodyFields(dstField, src.Field(i))
+			continue
+		}
+		if dstField.CanSet() {
+			dstField.Set(src.Field(i))
+		}
+	}
+}
+
+func (ctx *Context) bindSource(
+	dst reflect.Value,
+	tag string,
+	values url.Values,
+	normalize func(string) string,
+) ValidationErrors {
+	if len(values) == 0 {
+		return nil
+	}
+	binder := newFormBinder(ctx, values)
+	binder.tag = tag
+	binder.explicit = true
+	binder.normalize = normalize
+	binder.bindStruct(dst, "", 0)
+	return binder.result()
+}
+
+func (ctx *Context) cookieValues() url.Values {
+	values := url.Values{}
+	for _, cookie := range ctx.Req.Cookies() {
+		if ctx.cy == nil {
+			values.Add(cookie.Name, cookie.Value)
+			continue
+		}
+		decoded, err := cypher.DecodeCookie(ctx.cy, cookie.Value)
+		if err != nil {
+			continue
+		}
+		values.Add(cookie.Name, decoded)
+	}
+	return values
+}
+
+func mergeValidationErrors(dst ValidationErrors, src map[string][]core.ValidationError) {
+	for key, errs := range src {
+		dst[key] = append(dst[key], errs...)
+	}
+}
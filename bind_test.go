@@ -0,0 +1,87 @@
+package phx_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/deltegui/phx"
+	"github.com/deltegui/phx/phxtest"
+)
+
+type bindTarget struct {
+	Tenant  string `header:"X-Tenant" json:"tenant"`
+	Role    string `cookie:"role" json:"role"`
+	Page    int    `query:"page" json:"page"`
+	Name    string `json:"name"`
+	Address struct {
+		Zone   string `header:"X-Zone" json:"zone"`
+		Street string `json:"street"`
+	} `json:"address"`
+}
+
+func newBindClient(t *testing.T) *phxtest.Client {
+	r := phx.NewRouter()
+	r.Post("/bind", func() phx.Handler {
+		return func(ctx *phx.Context) error {
+			var target bindTarget
+			if err := ctx.Bind(&target); err != nil {
+				return err
+			}
+			return ctx.JsonOk(target)
+		}
+	})
+	return phxtest.New(t, r)
+}
+
+func decodeBindTarget(t *testing.T, res *phxtest.Response) bindTarget {
+	t.Helper()
+	res.AssertStatus(http.StatusOK)
+	var target bindTarget
+	if err := json.Unmarshal(res.Body, &target); err != nil {
+		t.Fatalf("cannot decode response: %s", err)
+	}
+	return target
+}
+
+func TestBindIgnoresSourceFieldsInJsonBody(t *testing.T) {
+	c := newBindClient(t)
+	body := `{"tenant":"evil","role":"admin","page":7,"name":"a","address":{"zone":"evil","street":"main"}}`
+	target := decodeBindTarget(t, c.Post("/bind", "application/json", strings.NewReader(body)))
+	if target.Tenant != "" || target.Role != "" || target.Page != 0 || target.Address.Zone != "" {
+		t.Errorf("body overrode fields read from other sources: %+v", target)
+	}
+	if target.Name != "a" || target.Address.Street != "main" {
+		t.Errorf("body fields were not bound: %+v", target)
+	}
+}
+
+func TestBindIgnoresSourceFieldsInForm(t *testing.T) {
+	c := newBindClient(t)
+	form := url.Values{"Role": {"admin"}, "Tenant": {"evil"}, "Name": {"a"}}
+	req := httptest.NewRequest(http.MethodPost, "/bind?Tenant=q&Page=3", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	target := decodeBindTarget(t, c.Do(req))
+	if target.Tenant != "" || target.Role != "" || target.Page != 0 {
+		t.Errorf("form overrode fields read from other sources: %+v", target)
+	}
+	if target.Name != "a" {
+		t.Errorf("form fields were not bound: %+v", target)
+	}
+}
+
+func TestBindReadsSourceFields(t *testing.T) {
+	c := newBindClient(t)
+	req := httptest.NewRequest(http.MethodPost, "/bind?page=2", strings.NewReader(`{"tenant":"evil"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Zone", "eu")
+	req.AddCookie(&http.Cookie{Name: "role", Value: "user"})
+	target := decodeBindTarget(t, c.Do(req))
+	if target.Tenant != "acme" || target.Role != "user" || target.Page != 2 || target.Address.Zone != "eu" {
+		t.Errorf("fields were not read from their sources: %+v", target)
+	}
+}
@@ -3,7 +3,6 @@ package csrf
 import (
 	"crypto/rand"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +10,7 @@ import (
 
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/cypher"
+	"github.com/deltegui/phx/logging"
 )
 
 const CsrfHeaderName string = "X-Csrf-Token"
@@ -30,7 +30,7 @@ func New(expires time.Duration, cipher core.Cypher) *Csrf {
 func (csrf *Csrf) encrypt(raw string) string {
 	encoded, err := cypher.EncodeCookie(csrf.cipher, raw)
 	if err != nil {
-		log.Println("Cannot encode csrf token:", err)
+		logging.Logger().Error("cannot encode csrf token", "error", err)
 		return ""
 	}
 	return encoded
@@ -48,7 +48,7 @@ func (csrf Csrf) Generate() string {
 	unixTime := time.Now().Unix()
 	prime, err := rand.Prime(rand.Reader, core.Size64)
 	if err != nil {
-		log.Panicln(err)
+		logging.Panic("cannot create prime number for csrf token", err)
 	}
 	raw := fmt.Sprintf("%d//00//%d", prime.Int64(), unixTime)
 	e := csrf.encrypt(raw)
@@ -58,24 +58,24 @@ func (csrf Csrf) Generate() string {
 func (csrf Csrf) Check(token string) bool {
 	raw, err := csrf.decrypt(token)
 	if err != nil {
-		log.Println("Cannot decrypt csrf token: ", err)
+		logging.Logger().Warn("cannot decrypt csrf token", "error", err)
 		return false
 	}
 	parts := strings.Split(raw, "//00//")
 	const minimumParts = 2
 	if len(parts) < minimumParts {
-		log.Println("Malformed csrf token. Not enough parts.")
+		logging.Logger().Warn("malformed csrf token: not enough parts")
 		return false
 	}
 	unixTime := parts[0]
 	i, err := strconv.ParseInt(unixTime, core.IntBase10, core.Size64)
 	if err != nil {
-		log.Println("Malformed csrf token. Unixtime is not int64.")
+		logging.Logger().Warn("malformed csrf token: unix time is not int64")
 		return false
 	}
 	t := time.Unix(i, 0)
 	if t.After(time.Now().Add(-csrf.expires)) {
-		log.Println("Expired csrf token!")
+		logging.Logger().Info("expired csrf token")
 		return false
 	}
 	return true
@@ -86,7 +86,7 @@ func (csrf Csrf) CheckRequest(req *http.Request) bool {
 	if len(token) == 0 {
 		token = req.Header.Get(CsrfHeaderName)
 		if len(token) == 0 {
-			log.Printf("Csrf header (%s) token not found\n", CsrfHeaderName)
+			logging.Logger().Info("csrf token not found", "header", CsrfHeaderName)
 			return false
 		}
 		return csrf.Check(token)
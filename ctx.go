@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"reflect"
+	"slices"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -13,31 +15,199 @@ import (
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/cypher"
 	"github.com/deltegui/phx/localizer"
+	"github.com/deltegui/phx/logging"
 	"github.com/deltegui/phx/pagination"
+	"github.com/deltegui/phx/requestid"
 	"github.com/deltegui/phx/session"
 )
 
 type Context struct {
 	Req    *http.Request
 	Res    http.ResponseWriter
+	rw     *responseWriter
 	params httprouter.Params
-	ctx    context.Context
 
 	locstore *localizer.Store
 
 	renderer Renderer
 
-	validate core.Validator
+	validate    core.Validator
+	formOptions FormOptions
+	converters  map[reflect.Type]reflect.Value
 
 	cy core.Cypher
+
+	scope *Scope
+
+	router *Router
+	route  *Route
+
+	// Keys set with Set, in order.
+	keys []any
+
+	afterResponse []func()
+
+	session *session.Session
+
+	// Flash messages, see Flash and Flashes.
+	flashes            []Flash
+	flashesRead        bool
+	flashCookie        []Flash
+	flashCookieLoaded  bool
+	flashCookieChanged bool
+}
+
+// GetByType returns a dependency registered in the Router's injector.
+// Scoped dependencies are shared during the request.
+func (ctx *Context) GetByType(name reflect.Type) (interface{}, error) {
+	return ctx.scope.GetByType(name)
+}
+
+// Run calls the runner injecting its parameters, including scoped
+// dependencies. See Runner type for more information.
+func (ctx *Context) Run(runner Runner) {
+	ctx.scope.Run(runner)
+}
+
+// AfterResponse registers a function that is called when the request has
+// been handled, after the ErrorHandler. Functions are called in reverse
+// registration order.
+func (ctx *Context) AfterResponse(fn func()) {
+	ctx.afterResponse = append(ctx.afterResponse, fn)
 }
 
+func (ctx *Context) close() {
+	if !ctx.rw.written && len(ctx.rw.hooks) > 0 {
+		// Nothing was written, so net/http would send the headers
+		// without calling the hooks.
+		ctx.rw.WriteHeader(http.StatusOK)
+	}
+	for i := len(ctx.afterResponse) - 1; i >= 0; i-- {
+		ctx.afterResponse[i]()
+	}
+	if err := ctx.scope.Close(); err != nil {
+		ctx.Logger().Error("cannot close request scoped dependencies", "error", err)
+	}
+	// net/http only removes the temporary files of the multipart form
+	// parsed in the original request, and ctx.Req is a copy after Set.
+	if ctx.Req.MultipartForm != nil {
+		if err := ctx.Req.MultipartForm.RemoveAll(); err != nil {
+			ctx.Logger().Error("cannot remove multipart form files", "error", err)
+		}
+	}
+}
+
+// Logger returns the phx logger (see package logging) with the attributes
+// of the request: method, path, matched route and, if any, the id of the
+// authenticated user and the request id.
+func (ctx *Context) Logger() *slog.Logger {
+	attrs := []any{
+		slog.String("method", ctx.Req.Method),
+		slog.String("path", ctx.Req.URL.Path),
+	}
+	if ctx.route != nil {
+		route := ctx.route.pattern
+		if len(route) == 0 {
+			route = ctx.route.name
+		}
+		attrs = append(attrs, slog.String("route", route))
+	}
+	if user, ok := ctx.Get(session.ContextKey).(session.User); ok {
+		attrs = append(attrs, slog.Int64("user", user.Id))
+	}
+	if id := ctx.RequestId(); len(id) > 0 {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	return logging.Logger().With(attrs...)
+}
+
+// RequestId returns the id of the request set by middleware.RequestId or
+// an empty string if there is none.
+func (ctx *Context) RequestId() string {
+	id, _ := requestid.FromContext(ctx)
+	return id
+}
+
+func logPlainCookies() {
+	logging.Logger().Warn("using plain cookies. " +
+		"You must provide a core.Cypher implementation to use encoded cookies")
+}
+
+// Context implements context.Context using the request's context, so it
+// can be passed to use cases and it is cancelled when the client goes away.
+var _ context.Context = (*Context)(nil)
+
+func (ctx *Context) Deadline() (time.Time, bool) {
+	return ctx.Req.Context().Deadline()
+}
+
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.Req.Context().Done()
+}
+
+func (ctx *Context) Err() error {
+	return ctx.Req.Context().Err()
+}
+
+func (ctx *Context) Value(key any) any {
+	return ctx.Req.Context().Value(key)
+}
+
+// Context returns the request's context.
+func (ctx *Context) Context() context.Context {
+	return ctx.Req.Context()
+}
+
+// WithContext replaces the request's context. Use it to derive contexts
+// with deadlines or values that must reach the next handlers.
+func (ctx *Context) WithContext(c context.Context) {
+	ctx.Req = ctx.Req.WithContext(c)
+}
+
+// Set stores a value in the request's context, so it is also available
+// to stdlib handlers using Req.Context().
 func (ctx *Context) Set(key, value any) {
-	ctx.ctx = context.WithValue(ctx.ctx, key, value)
+	if !slices.Contains(ctx.keys, key) {
+		ctx.keys = append(ctx.keys, key)
+	}
+	ctx.WithContext(context.WithValue(ctx.Req.Context(), key, value))
+}
+
+// Keys returns the keys of the values stored with Set.
+func (ctx *Context) Keys() []any {
+	return slices.Clone(ctx.keys)
+}
+
+// Route returns the matched route. For requests that do not match any
+// route it is the NotFound or MethodNotAllowed handler route.
+func (ctx *Context) Route() *Route {
+	return ctx.route
 }
 
 func (ctx *Context) Get(key any) any {
-	return ctx.ctx.Value(key)
+	return ctx.Value(key)
+}
+
+// ResponseWritten reports if the response status have been already sent.
+func (ctx *Context) ResponseWritten() bool {
+	return ctx.rw != nil && ctx.rw.written
+}
+
+// ResponseSize returns the number of bytes of body sent to the client.
+func (ctx *Context) ResponseSize() int {
+	if ctx.rw == nil {
+		return 0
+	}
+	return ctx.rw.size
+}
+
+// ResponseStatus returns the status sent to the client. Only meaningful
+// if ResponseWritten returns true.
+func (ctx *Context) ResponseStatus() int {
+	if ctx.rw == nil {
+		return 0
+	}
+	return ctx.rw.status
 }
 
 func (ctx *Context) PaginationToVM(pag pagination.Pagination) pagination.ViewModel {
@@ -68,6 +238,76 @@ func (ctx *Context) GetUser() session.User {
 	return ctx.Get(session.ContextKey).(session.User)
 }
 
+// Session returns the session of the request, read with the registered
+// *session.Manager. It is read once per request and, if some value is
+// changed, saved when the request ends. An error is returned if there is
+// no valid session.
+func (ctx *Context) Session() (*session.Session, error) {
+	if ctx.session != nil {
+		return ctx.session, nil
+	}
+	manager, err := ctx.sessionManager()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read session: %w", err)
+	}
+	sess, err := manager.Authenticate(ctx.Res, ctx.Req)
+	if err != nil {
+		return nil, err
+	}
+	ctx.session = sess
+	ctx.AfterResponse(sess.Save)
+	return sess, nil
+}
+
+// Login creates a new session for the user, destroying the current one,
+// and sets the session cookie. See session.Manager.Login.
+func (ctx *Context) Login(user session.User) error {
+	manager, err := ctx.sessionManager()
+	if err != nil {
+		return fmt.Errorf("cannot login: %w", err)
+	}
+	if ctx.session != nil {
+		// Write pending values so they are kept in the new session.
+		ctx.session.Save()
+	}
+	sess := manager.Login(ctx.Res, ctx.Req, user)
+	ctx.session = sess
+	ctx.AfterResponse(sess.Save)
+	ctx.Set(session.ContextKey, user)
+	return nil
+}
+
+// RegenerateSession changes the id of the current session, updating its
+// user. Call it when the privileges of the user change. See
+// session.Manager.Regenerate.
+func (ctx *Context) RegenerateSession(user session.User) error {
+	sess, err := ctx.Session()
+	if err != nil {
+		return err
+	}
+	manager, err := ctx.sessionManager()
+	if err != nil {
+		return fmt.Errorf("cannot regenerate session: %w", err)
+	}
+	manager.Regenerate(ctx.Res, sess, user)
+	if ctx.HaveSession() {
+		ctx.Set(session.ContextKey, user)
+	}
+	return nil
+}
+
+func (ctx *Context) sessionManager() (*session.Manager, error) {
+	instance, err := ctx.scope.GetByType(reflect.TypeOf(&session.Manager{}))
+	if err != nil {
+		return nil, err
+	}
+	manager, ok := instance.(*session.Manager)
+	if !ok {
+		return nil, fmt.Errorf("registered session manager is %T", instance)
+	}
+	return manager, nil
+}
+
 func (ctx *Context) HaveSession() bool {
 	instance := ctx.Get(session.ContextKey)
 	if instance == nil {
@@ -89,6 +329,21 @@ func (ctx *Context) RedirectCode(to string, code int) error {
 	return nil
 }
 
+// URL builds the path of a named route. See Router.URL.
+func (ctx *Context) URL(name string, params ...any) (string, error) {
+	return ctx.router.URL(name, params...)
+}
+
+// RedirectRoute redirects to a named route with 303 (See Other), so it can
+// be used after handling a form. See Router.URL.
+func (ctx *Context) RedirectRoute(name string, params ...any) error {
+	to, err := ctx.URL(name, params...)
+	if err != nil {
+		return err
+	}
+	return ctx.RedirectCode(to, http.StatusSeeOther)
+}
+
 func (ctx *Context) GetURLParam(name string) string {
 	return ctx.params.ByName(name)
 }
@@ -149,8 +404,8 @@ func (ctx *Context) Json(status int, data any) error {
 	if err != nil {
 		return fmt.Errorf("error marshaling data: %w", err)
 	}
-	ctx.Res.WriteHeader(status)
 	ctx.Res.Header().Set("Content-Type", "application/json")
+	ctx.Res.WriteHeader(status)
 	_, err = ctx.Res.Write(response)
 	return err
 }
@@ -217,8 +472,7 @@ func (ctx *Context) CreateCookieOptions(opt CookieOptions) error {
 			return fmt.Errorf("error encoding cookie: %w", err)
 		}
 	} else {
-		log.Println("[PHX] WARNING!: Using plain cookies. " +
-			"You must provide a core.Cypher implementation to use encoded cookies")
+		logPlainCookies()
 		data = opt.Value
 	}
 	http.SetCookie(ctx.Res, &http.Cookie{
@@ -256,16 +510,14 @@ func (ctx *Context) ReadCookie(name string) (string, error) {
 			return "", fmt.Errorf("cannot decode cookie: %w", err)
 		}
 	} else {
-		log.Println("[PHX] WARNING!: Using plain cookies. " +
-			"You must provide a core.Cypher implementation to use encoded cookies")
+		logPlainCookies()
 		data = cookie.Value
 	}
 	return data, nil
 }
 func (ctx *Context) DeleteCookie(name string) error {
 	if ctx.cy == nil {
-		log.Println("[PHX] WARNING!: Using plain cookies. " +
-			"You must provide a core.Cypher implementation to use encoded cookies")
+		logPlainCookies()
 	}
 	_, err := ctx.Req.Cookie(name)
 	if err != nil {
@@ -8,9 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 
 	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/logging"
 )
 
 type AES256 struct {
@@ -20,7 +20,7 @@ type AES256 struct {
 func GenerateRandomPass() []byte {
 	bytes := make([]byte, core.Size32) // generate a random 32 byte key for AES-256
 	if _, err := rand.Read(bytes); err != nil {
-		log.Fatalln("Cannot generate random key for aes encryptation in CSRF", err)
+		logging.Fatal("cannot generate random key for AES encryption", err)
 	}
 	return bytes
 }
@@ -31,15 +31,15 @@ func GenerateRandomPassAsString() string {
 
 func generateCipher(pass []byte) cipher.AEAD {
 	if len(pass) != core.Size32 {
-		log.Fatalln("The csrf encrypt password must be 32 bit long")
+		logging.Fatal("the cypher password must be 32 bytes long", nil)
 	}
 	aes, err := aes.NewCipher(pass)
 	if err != nil {
-		log.Fatalln("Cannot create cipher for CSRF", err)
+		logging.Fatal("cannot create AES cipher", err)
 	}
 	gcm, err := cipher.NewGCM(aes)
 	if err != nil {
-		log.Fatalln("Cannot create CGM:", err)
+		logging.Fatal("cannot create GCM", err)
 	}
 	return gcm
 }
@@ -59,7 +59,7 @@ func NewWithPassword(password []byte) core.Cypher {
 func NewWithPasswordAsString(password string) core.Cypher {
 	bytes, err := base64.RawStdEncoding.DecodeString(password)
 	if err != nil {
-		log.Panicln("Cannot decode password for cypher:", err)
+		logging.Panic("cannot decode cypher password", err)
 	}
 	return NewWithPassword(bytes)
 }
@@ -0,0 +1,248 @@
+package phx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/deltegui/phx/core"
+)
+
+// ErrNotFound can be returned by handlers (or wrapped by other errors) when
+// the requested resource does not exist. By default it is mapped to a 404.
+var ErrNotFound = errors.New("not found")
+
+// HttpError is an error that carries the status code that should be sent
+// to the client.
+type HttpError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func NewHttpError(status int, message string) HttpError {
+	return HttpError{
+		Status:  status,
+		Message: message,
+	}
+}
+
+func (httpErr HttpError) Error() string {
+	if httpErr.Err != nil {
+		return fmt.Sprintf("[%d] %s: %s", httpErr.Status, httpErr.Message, httpErr.Err)
+	}
+	return fmt.Sprintf("[%d] %s", httpErr.Status, httpErr.Message)
+}
+
+func (httpErr HttpError) Unwrap() error {
+	return httpErr.Err
+}
+
+// ValidationErrors is the error version of the map returned by validators,
+// so it can be returned by handlers. By default it is mapped to a 400.
+type ValidationErrors map[string][]core.ValidationError
+
+func (verrs ValidationErrors) Error() string {
+	fields := make([]string, 0, len(verrs))
+	for field, errs := range verrs {
+		for _, err := range errs {
+			fields = append(fields, fmt.Sprintf("%s: %s", field, err.Error()))
+		}
+	}
+	return fmt.Sprintf("validation failed (%s)", strings.Join(fields, ", "))
+}
+
+// ErrorMapper inspects an error returned by a handler and, if it knows it,
+// returns the status code that should be sent to the client.
+type ErrorMapper func(err error) (int, bool)
+
+// ErrorIs maps all errors that match target using errors.Is to status.
+func ErrorIs(target error, status int) ErrorMapper {
+	return func(err error) (int, bool) {
+		return status, errors.Is(err, target)
+	}
+}
+
+// ErrorAs maps all errors that can be converted to T using errors.As to status.
+func ErrorAs[T error](status int) ErrorMapper {
+	return func(err error) (int, bool) {
+		var target T
+		return status, errors.As(err, &target)
+	}
+}
+
+// ErrorUseCase maps the core.UseCaseError with the provided code to status.
+func ErrorUseCase(code uint16, status int) ErrorMapper {
+	return func(err error) (int, bool) {
+		var caseErr core.UseCaseError
+		return status, errors.As(err, &caseErr) && caseErr.Code == code
+	}
+}
+
+func defaultErrorMappers() []ErrorMapper {
+	return []ErrorMapper{
+		func(err error) (int, bool) {
+			var httpErr HttpError
+			if errors.As(err, &httpErr) {
+				return httpErr.Status, true
+			}
+			return 0, false
+		},
+		ErrorAs[ValidationErrors](http.StatusBadRequest),
+		ErrorAs[core.UseCaseError](http.StatusBadRequest),
+		ErrorIs(ErrNotFound, http.StatusNotFound),
+		ErrorIs(context.DeadlineExceeded, http.StatusServiceUnavailable),
+	}
+}
+
+// MapError registers a new ErrorMapper. Mappers registered later take
+// precedence over the previous ones and over the default mappers.
+func (r *Router) MapError(mapper ErrorMapper) {
+	if r.parent != nil {
+		r.parent.MapError(mapper)
+		return
+	}
+	r.errorMappers = append(r.errorMappers, mapper)
+}
+
+// ErrorStatus returns the status code that corresponds to an error using
+// the registered ErrorMappers. If the error is unknown, a 500 is returned.
+func (r *Router) ErrorStatus(err error) int {
+	if r.parent != nil {
+		return r.parent.ErrorStatus(err)
+	}
+	for i := len(r.errorMappers) - 1; i >= 0; i-- {
+		if status, ok := r.errorMappers[i](err); ok {
+			return status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorTemplate sets a template (a parsed name of the registered Renderer)
+// to render errors with the provided status when the client wants HTML.
+// Use status 0 to set the template used when no other template matches.
+// The template receives an ErrorModel as model.
+func (r *Router) ErrorTemplate(status int, parsed string) {
+	if r.parent != nil {
+		r.parent.ErrorTemplate(status, parsed)
+		return
+	}
+	r.errorTemplates[status] = parsed
+}
+
+// ErrorModel is the model passed to error templates and the body of JSON
+// error responses.
+type ErrorModel struct {
+	Status  int                 `json:"status"`
+	Title   string              `json:"title"`
+	Message string              `json:"message"`
+	Code    uint16              `json:"code,omitempty"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+
+	// RequestId is set if middleware.RequestId is used, so users can
+	// report it.
+	RequestId string `json:"requestId,omitempty"`
+}
+
+func (r *Router) createErrorModel(ctx *Context, err error) ErrorModel {
+	status := r.ErrorStatus(err)
+	model := ErrorModel{
+		Status:    status,
+		Title:     http.StatusText(status),
+		Message:   http.StatusText(status),
+		RequestId: ctx.RequestId(),
+	}
+	if status >= http.StatusInternalServerError {
+		return model
+	}
+	model.Message = err.Error()
+	var caseErr core.UseCaseError
+	if errors.As(err, &caseErr) {
+		model.Code = caseErr.Code
+		model.Message = caseErr.Reason
+		if ctx.HaveLocalizer() {
+			if localized := ctx.LocalizeError(caseErr); len(localized) > 0 {
+				model.Message = localized
+			}
+		}
+	}
+	var httpErr HttpError
+	if errors.As(err, &httpErr) {
+		model.Message = httpErr.Message
+	}
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		model.Message = http.StatusText(status)
+		model.Fields = make(map[string][]string, len(verrs))
+		for field, errs := range verrs {
+			for _, e := range errs {
+				model.Fields[field] = append(model.Fields[field], e.Error())
+			}
+		}
+	}
+	return model
+}
+
+func (r *Router) errorTemplateFor(status int) (string, bool) {
+	if parsed, ok := r.errorTemplates[status]; ok {
+		return parsed, true
+	}
+	parsed, ok := r.errorTemplates[0]
+	return parsed, ok
+}
+
+func wantsJson(ctx *Context) bool {
+	if ctx.route != nil && ctx.route.preferJson {
+		return true
+	}
+	req := ctx.Req
+	accept := req.Header.Get("Accept")
+	if len(accept) == 0 {
+		return strings.HasPrefix(req.Header.Get("Content-Type"), "application/json")
+	}
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// DefaultErrorHandler is the ErrorHandler used by routers. It logs the error
+// and, if nothing have been written to the response yet, sends the error to
+// the client using the status returned by the ErrorMappers. The body is
+// a JSON ErrorModel if the client accepts JSON or the route prefers it (see
+// Route.PreferJson), the registered error template if any or plain text
+// otherwise.
+func (r *Router) DefaultErrorHandler(ctx *Context, err error) {
+	level := slog.LevelError
+	if r.ErrorStatus(err) < http.StatusInternalServerError {
+		level = slog.LevelWarn
+	}
+	ctx.Logger().Log(ctx, level, "error handling request", "error", err)
+	if ctx.ResponseWritten() {
+		return
+	}
+	model := r.createErrorModel(ctx, err)
+	if wantsJson(ctx) {
+		if jsonErr := ctx.Json(model.Status, model); jsonErr != nil {
+			ctx.Logger().Error("cannot send JSON error response", "error", jsonErr)
+		}
+		return
+	}
+	if parsed, ok := r.errorTemplateFor(model.Status); ok && ctx.renderer != nil {
+		if renderErr := ctx.Render(model.Status, parsed, model); renderErr != nil {
+			ctx.Logger().Error("cannot render error template", "template", parsed, "error", renderErr)
+		}
+		return
+	}
+	ctx.String(model.Status, "%s", model.Message)
+}
+
+var defaultErrorHandlerPointer = reflect.ValueOf((&Router{}).DefaultErrorHandler).Pointer()
+
+// isDefaultErrorHandler reports if the handler is the DefaultErrorHandler
+// method of any router.
+func isDefaultErrorHandler(handler func(*Context, error)) bool {
+	return handler == nil || reflect.ValueOf(handler).Pointer() == defaultErrorHandlerPointer
+}
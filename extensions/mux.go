@@ -2,6 +2,8 @@ package extensions
 
 import (
 	"embed"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/deltegui/phx"
@@ -11,25 +13,26 @@ import (
 	"github.com/deltegui/phx/hash"
 	"github.com/deltegui/phx/middleware"
 	"github.com/deltegui/phx/renderer"
+	"github.com/deltegui/phx/requestid"
 	"github.com/deltegui/phx/session"
 )
 
 func AddCypherWithPassword(r *phx.Router, password string) {
-	r.Add(func() core.Cypher {
+	r.AddSingleton(func() core.Cypher {
 		return cypher.NewWithPasswordAsString(password)
 	})
 }
 
 func AddHasher(r *phx.Router) {
-	r.Add(func() core.Hasher { return hash.BcryptHasher{} })
+	r.AddSingleton(func() core.Hasher { return hash.BcryptHasher{} })
 }
 
 func AddCypher(r *phx.Router) {
-	r.Add(func() core.Cypher { return cypher.New() })
+	r.AddSingleton(func() core.Cypher { return cypher.New() })
 }
 
 func UseCsrf(r *phx.Router, duration time.Duration) {
-	r.Add(func(cy core.Cypher) *csrf.Csrf {
+	r.AddSingleton(func(cy core.Cypher) *csrf.Csrf {
 		return csrf.New(duration, cy)
 	})
 	r.Run(func(c *csrf.Csrf) {
@@ -37,26 +40,65 @@ func UseCsrf(r *phx.Router, duration time.Duration) {
 	})
 }
 
+// AddSession registers a *session.Manager that keeps the sessions in
+// memory. Expired sessions are swept periodically while the server runs.
 func AddSession(r *phx.Router, duration time.Duration) {
-	r.Add(func(hasher core.Hasher, cy core.Cypher) *session.Manager {
-		return session.NewManager(
-			session.NewMemoryStore(),
-			hasher,
-			duration,
-			cy)
-	})
+	AddSessionWithStore(r, duration, session.NewMemoryStore())
 }
 
+// AddSessionWithStore registers a *session.Manager that uses the store. If
+// the store implements session.Sweeper, expired sessions are swept
+// periodically while the server runs. Stores that already sweep their
+// entries themselves (see session.SelfSweeper) are just stopped when the
+// server stops.
 func AddSessionWithStore(r *phx.Router, duration time.Duration, store session.SessionStore) {
-	r.Add(func(hasher core.Hasher, cy core.Cypher) *session.Manager {
-		return session.NewManager(
-			store,
-			hasher,
-			duration,
-			cy)
+	AddSessionWithOptions(r, store, session.ManagerOptions{
+		IdleTimeout: duration,
+	})
+}
+
+// AddSessionWithOptions is like AddSessionWithStore, but the lifetime of
+// the sessions and the session cookie are configured using options.
+func AddSessionWithOptions(r *phx.Router, store session.SessionStore, options session.ManagerOptions) {
+	if self, ok := store.(session.SelfSweeper); ok && self.Sweeping() {
+		r.OnShutdown(self.Stop)
+	} else if sweeper, ok := store.(session.Sweeper); ok {
+		sweeping := &serverSweeping{sweeper: sweeper}
+		r.OnStart(sweeping.start)
+		r.OnShutdown(sweeping.stop)
+	}
+	r.AddSingleton(func(hasher core.Hasher, cy core.Cypher) *session.Manager {
+		return session.NewManagerWithOptions(store, hasher, cy, options)
 	})
 }
 
+// serverSweeping runs a session.Janitor while a server runs, so routers
+// that are never started (like the ones used by tests) do not leak it.
+type serverSweeping struct {
+	sweeper session.Sweeper
+	mutex   sync.Mutex
+	janitor *session.Janitor
+	stopped bool
+}
+
+func (sweeping *serverSweeping) start() {
+	sweeping.mutex.Lock()
+	defer sweeping.mutex.Unlock()
+	if sweeping.stopped || sweeping.janitor != nil {
+		return
+	}
+	sweeping.janitor = session.NewJanitor(sweeping.sweeper, session.DefaultSweepInterval)
+}
+
+func (sweeping *serverSweeping) stop() {
+	sweeping.mutex.Lock()
+	defer sweeping.mutex.Unlock()
+	sweeping.stopped = true
+	if sweeping.janitor != nil {
+		sweeping.janitor.Stop()
+	}
+}
+
 type Authorization struct {
 	redirect string
 	manager  *session.Manager
@@ -90,11 +132,31 @@ func (auth Authorization) Admin() phx.Middleware {
 func AddRendering(r *phx.Router, fs embed.FS) *renderer.TemplateRenderer {
 	rend := renderer.NewTemplateRenderer(fs)
 	rend.AddDefaultTemplateFunctions()
-	r.Add(func() phx.Renderer { return rend })
-	r.Add(func() *renderer.TemplateRenderer { return rend })
+	rend.SetURLResolver(r.URL)
+	r.AddSingleton(func() phx.Renderer { return rend })
+	r.AddSingleton(func() *renderer.TemplateRenderer { return rend })
 	return rend
 }
 
+// AddHttpClient registers an *http.Client that propagates the request id
+// (see middleware.RequestId) to other services. Create the requests with
+// the phx.Context:
+//
+//	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+//	res, err := client.Do(req)
+func AddHttpClient(r *phx.Router, timeout time.Duration) {
+	r.AddSingleton(func() *http.Client {
+		return &http.Client{
+			Timeout:   timeout,
+			Transport: requestid.Transport{Base: http.DefaultTransport},
+		}
+	})
+}
+
+func UseRequestId(r *phx.Router) {
+	r.Use(middleware.RequestId)
+}
+
 func UseCors(r *phx.Router, opt middleware.CorsOptions) {
 	r.Use(middleware.Cors(opt))
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"os"
 	"strings"
 	"time"
@@ -37,6 +38,29 @@ func (s Store) Save(buffer []byte, relativePath string) (string, error) {
 	return s.generateURL(relativePath), nil
 }
 
+// SaveReader copies everything from the reader to the file.
+func (s Store) SaveReader(reader io.Reader, relativePath string) (string, error) {
+	file, fullPath, err := s.createFile(relativePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, reader); err != nil {
+		return "", fmt.Errorf("error writing to file with path: '%s'. Error: %w", fullPath, err)
+	}
+	return s.generateURL(relativePath), nil
+}
+
+// SaveUpload stores a file uploaded with a multipart form.
+func (s Store) SaveUpload(header *multipart.FileHeader, relativePath string) (string, error) {
+	upload, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("cannot open uploaded file '%s': %w", header.Filename, err)
+	}
+	defer upload.Close()
+	return s.SaveReader(upload, relativePath)
+}
+
 func (s Store) generateURL(relativePath string) string {
 	return fmt.Sprintf("%s/%s", s.url, relativePath)
 }
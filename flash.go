@@ -0,0 +1,160 @@
+package phx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/deltegui/phx/cypher"
+	"github.com/deltegui/phx/session"
+)
+
+// Flash is a message stored to be shown in the next page, usually after
+// a redirect.
+type Flash struct {
+	Kind    string
+	Message string
+}
+
+// Common flash kinds.
+const (
+	FlashSuccess string = "success"
+	FlashInfo    string = "info"
+	FlashWarning string = "warning"
+	FlashError   string = "error"
+)
+
+const (
+	flashCookieName string = "phx_flash"
+	flashSessionKey string = "phx_flashes"
+)
+
+// Flash stores a message to be shown in the next page:
+//
+//	ctx.Flash(phx.FlashSuccess, "user.saved")
+//	return ctx.RedirectRoute("users.list")
+//
+// If the request has a session (see Session), the message is kept in it.
+// Otherwise it is kept in a cookie, encrypted with the registered
+// core.Cypher if there is one, that is set when the response headers are
+// written. Messages are consumed by Flashes. Templates can read them with
+// model.ViewModel.Flashes, localized as keys of the view localization.
+func (ctx *Context) Flash(kind, message string) error {
+	flash := Flash{Kind: kind, Message: message}
+	if sess, err := ctx.Session(); err == nil {
+		var flashes []Flash
+		if err := sess.Get(flashSessionKey, &flashes); err != nil && err != session.ErrNoValue {
+			return err
+		}
+		return sess.Set(flashSessionKey, append(flashes, flash))
+	}
+	ctx.loadFlashCookie()
+	ctx.flashCookie = append(ctx.flashCookie, flash)
+	ctx.flashCookieChanged = true
+	return nil
+}
+
+// Flashes returns the stored messages and removes them, so they are only
+// shown once. The messages are kept during the request, so calling it
+// again returns the same ones.
+func (ctx *Context) Flashes() []Flash {
+	if ctx.flashesRead {
+		return ctx.flashes
+	}
+	ctx.flashesRead = true
+	if sess, err := ctx.Session(); err == nil {
+		if err := sess.Get(flashSessionKey, &ctx.flashes); err != nil && err != session.ErrNoValue {
+			ctx.Logger().Warn("cannot read flash messages from session", "error", err)
+		}
+		sess.Delete(flashSessionKey)
+	}
+	ctx.loadFlashCookie()
+	if len(ctx.flashCookie) > 0 {
+		ctx.flashes = append(ctx.flashes, ctx.flashCookie...)
+		ctx.flashCookie = nil
+		ctx.flashCookieChanged = true
+	}
+	return ctx.flashes
+}
+
+// loadFlashCookie reads the messages of the request's flash cookie once and
+// registers the function that writes the cookie back if it changes.
+func (ctx *Context) loadFlashCookie() {
+	if ctx.flashCookieLoaded {
+		return
+	}
+	ctx.flashCookieLoaded = true
+	ctx.rw.beforeWriteHeader(ctx.writeFlashCookie)
+	cookie, err := ctx.Req.Cookie(flashCookieName)
+	if err != nil {
+		return
+	}
+	flashes, err := ctx.decodeFlashCookie(cookie.Value)
+	if err != nil {
+		ctx.Logger().Warn("discarding invalid flash messages cookie", "error", err)
+		ctx.flashCookieChanged = true
+		return
+	}
+	ctx.flashCookie = flashes
+}
+
+func (ctx *Context) decodeFlashCookie(value string) ([]Flash, error) {
+	var data []byte
+	if ctx.cy != nil {
+		decoded, err := cypher.DecodeCookie(ctx.cy, value)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(decoded)
+	} else {
+		var err error
+		data, err = base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var flashes []Flash
+	if err := json.Unmarshal(data, &flashes); err != nil {
+		return nil, err
+	}
+	return flashes, nil
+}
+
+// writeFlashCookie sets the flash cookie with the pending messages if they
+// have changed during the request. Without messages the cookie is deleted.
+func (ctx *Context) writeFlashCookie() {
+	if !ctx.flashCookieChanged {
+		return
+	}
+	if len(ctx.flashCookie) == 0 {
+		http.SetCookie(ctx.rw, &http.Cookie{
+			Name:     flashCookieName,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+		return
+	}
+	data, err := json.Marshal(ctx.flashCookie)
+	if err != nil {
+		ctx.Logger().Error("cannot encode flash messages", "error", err)
+		return
+	}
+	value := base64.RawURLEncoding.EncodeToString(data)
+	if ctx.cy != nil {
+		value, err = cypher.EncodeCookie(ctx.cy, string(data))
+		if err != nil {
+			ctx.Logger().Error("cannot encrypt flash messages cookie", "error", err)
+			return
+		}
+	} else {
+		logPlainCookies()
+	}
+	http.SetCookie(ctx.rw, &http.Cookie{
+		Name:     flashCookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
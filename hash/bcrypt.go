@@ -1,8 +1,7 @@
 package hash
 
 import (
-	"log"
-
+	"github.com/deltegui/phx/logging"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -13,7 +12,7 @@ type BcryptHasher struct{}
 func (hasher BcryptHasher) Hash(password string) string {
 	rawResult, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Fatal(err)
+		logging.Panic("cannot hash password", err)
 	}
 	return string(rawResult)
 }
@@ -1,15 +1,24 @@
 package phx
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deltegui/phx/logging"
 )
 
 // Builder is a function that expects anything and retuns
 // the type that builds. The type cant be func() interface{}
 // cause some errors appears in runtime. So it's represented
-// as an interface.
+// as an interface. Builders can also return (T, error). If the
+// error is not nil, the dependency is not created and the error
+// is reported to whoever asked for it.
 type Builder interface{}
 
 // Runner is any funtion that returns void. It is use
@@ -36,31 +45,118 @@ type Builder interface{}
 // The callback function will be exectued inmediatly.
 type Runner interface{}
 
+// Lifetime tells the injector how long an instance created by a builder lives.
+type Lifetime int
+
+const (
+	// Transient dependencies are built every time they are requested.
+	Transient Lifetime = iota
+	// Singleton dependencies are built once and shared by everyone.
+	Singleton
+	// Scoped dependencies are built once per Scope. Each request served by
+	// a Router have its own Scope, that is closed when the request ends.
+	Scoped
+)
+
+func (lifetime Lifetime) String() string {
+	switch lifetime {
+	case Transient:
+		return "transient"
+	case Singleton:
+		return "singleton"
+	case Scoped:
+		return "scoped"
+	default:
+		return fmt.Sprintf("Lifetime(%d)", int(lifetime))
+	}
+}
+
+type dependency struct {
+	builder  Builder
+	lifetime Lifetime
+
+	mutex    sync.Mutex
+	built    bool
+	instance interface{}
+}
+
 // Injector is an automated dependency injector inspired in Sping's
 // DI. It will detect which builder to call using its return type.
 // If the builder haver params, it will fullfill that params calling
 // other builders that provides its types.
 type Injector struct {
-	builders map[reflect.Type]Builder
+	builders map[reflect.Type]*dependency
 }
 
 // NewInjector with default values.
 func NewInjector() *Injector {
 	return &Injector{
-		builders: make(map[reflect.Type]Builder),
+		builders: make(map[reflect.Type]*dependency),
 	}
 }
 
-// Add a builder to the dependency injector.
+// Add a builder to the dependency injector. The dependency is transient.
 func (injector Injector) Add(builder Builder) {
-	outputType := reflect.TypeOf(builder).Out(0)
-	injector.builders[outputType] = builder
+	injector.AddTransient(builder)
+}
+
+// AddTransient adds a builder that is called every time its type is needed.
+func (injector Injector) AddTransient(builder Builder) {
+	injector.addWithLifetime(builder, Transient)
+}
+
+// AddSingleton adds a builder that is called only the first time its type
+// is needed. Later, the same instance is returned.
+func (injector Injector) AddSingleton(builder Builder) {
+	injector.addWithLifetime(builder, Singleton)
+}
+
+// AddScoped adds a builder that is called once per Scope (once per request).
+// Scoped dependencies cannot be injected into singletons or handler
+// builders. Resolve them inside handlers using Context.Run or
+// Context.GetByType. If the instance implements io.Closer it is
+// closed when the Scope ends.
+func (injector Injector) AddScoped(builder Builder) {
+	injector.addWithLifetime(builder, Scoped)
+}
+
+func (injector Injector) addWithLifetime(builder Builder, lifetime Lifetime) {
+	builderType := reflect.TypeOf(builder)
+	if err := checkBuilderType(builderType); err != nil {
+		panic(err)
+	}
+	injector.builders[builderType.Out(0)] = &dependency{
+		builder:  builder,
+		lifetime: lifetime,
+	}
+}
+
+func checkBuilderType(builderType reflect.Type) error {
+	if builderType == nil || builderType.Kind() != reflect.Func {
+		return fmt.Errorf("builder must be a function, got %s", builderType)
+	}
+	switch builderType.NumOut() {
+	case 1:
+		return nil
+	case 2:
+		if builderType.Out(1) != reflect.TypeOf((*error)(nil)).Elem() {
+			return fmt.Errorf("the second return value of builder %s must be an error", builderType)
+		}
+		return nil
+	default:
+		return fmt.Errorf("builder %s must return T or (T, error)", builderType)
+	}
+}
+
+func builderLocation(builder Builder) string {
+	name, source := funcLocation(builder)
+	return fmt.Sprintf("%s (%s)", name, source)
 }
 
 // ShowAvailableBuilders prints all registered builders.
 func (injector Injector) ShowAvailableBuilders() {
-	for k := range injector.builders {
-		log.Printf("Builder for type: %s\n", k)
+	for k, dep := range injector.builders {
+		logging.Logger().Info("builder", "type", k.String(), "lifetime", dep.lifetime.String())
 	}
 }
 
@@ -71,11 +167,51 @@ func (injector Injector) Get(name interface{}) (interface{}, error) {
 
 // GetByType returns a builded dependency identified by type.
 func (injector Injector) GetByType(name reflect.Type) (interface{}, error) {
-	dependencyBuilder := injector.builders[name]
-	if dependencyBuilder == nil {
+	return injector.resolve(name, nil, nil)
+}
+
+func (injector Injector) resolve(name reflect.Type, scope *Scope, path []reflect.Type) (interface{}, error) {
+	dep := injector.builders[name]
+	if dep == nil {
 		return nil, fmt.Errorf("builder not found for type %s", name)
 	}
-	return injector.CallBuilder(dependencyBuilder), nil
+	for _, visited := range path {
+		if visited == name {
+			return nil, fmt.Errorf("dependency cycle detected: %s", formatPath(append(path, name)))
+		}
+	}
+	path = append(path, name)
+	switch dep.lifetime {
+	case Singleton:
+		dep.mutex.Lock()
+		defer dep.mutex.Unlock()
+		if !dep.built {
+			instance, err := injector.callBuilder(dep.builder, nil, path)
+			if err != nil {
+				return nil, err
+			}
+			dep.instance = instance
+			dep.built = true
+		}
+		return dep.instance, nil
+	case Scoped:
+		if scope == nil {
+			return nil, fmt.Errorf("type %s is scoped and cannot be resolved outside a request", name)
+		}
+		return scope.get(name, dep, path)
+	case Transient:
+		return injector.callBuilder(dep.builder, scope, path)
+	default:
+		return nil, fmt.Errorf("unknown lifetime %s for type %s", dep.lifetime, name)
+	}
+}
+
+func formatPath(path []reflect.Type) string {
+	names := make([]string, len(path))
+	for i, t := range path {
+		names[i] = t.String()
+	}
+	return strings.Join(names, " -> ")
 }
 
 // ResolveHandler created by a builder.
@@ -84,20 +220,185 @@ func (injector Injector) ResolveHandler(builder Builder) Handler {
 }
 
 // CallBuilder injecting all parameters with provided builders. If some parameter
-// type cannot be found, it will panic.
+// type cannot be found or the builder returns an error, it will panic.
 func (injector Injector) CallBuilder(builder Builder) interface{} {
-	var inputs []reflect.Value
+	builded, err := injector.Build(builder)
+	if err != nil {
+		panic(err)
+	}
+	return builded
+}
+
+// Build calls the builder injecting all parameters with provided builders.
+// It returns an error if some parameter cannot be resolved or if the builder
+// returns one.
+func (injector Injector) Build(builder Builder) (interface{}, error) {
+	return injector.callBuilder(builder, nil, nil)
+}
+
+func (injector Injector) callBuilder(builder Builder, scope *Scope, path []reflect.Type) (interface{}, error) {
 	builderType := reflect.TypeOf(builder)
-	for i := range builderType.NumIn() {
-		impl, err := injector.GetByType(builderType.In(i))
+	if err := checkBuilderType(builderType); err != nil {
+		return nil, err
+	}
+	inputs, err := injector.resolveInputs(builderType, scope, path)
+	if err != nil {
+		return nil, err
+	}
+	builded := reflect.ValueOf(builder).Call(inputs)
+	if len(builded) == 2 && !builded[1].IsNil() {
+		err, _ := builded[1].Interface().(error)
+		return nil, fmt.Errorf("builder for type %s failed: %w", builderType.Out(0), err)
+	}
+	return builded[0].Interface(), nil
+}
+
+func (injector Injector) resolveInputs(funcType reflect.Type, scope *Scope, path []reflect.Type) ([]reflect.Value, error) {
+	var inputs []reflect.Value
+	for i := range funcType.NumIn() {
+		impl, err := injector.resolve(funcType.In(i), scope, path)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		inputs = append(inputs, reflect.ValueOf(impl))
 	}
-	builderVal := reflect.ValueOf(builder)
-	builded := builderVal.Call(inputs)
-	return builded[0].Interface()
+	return inputs, nil
+}
+
+// Verify walks every registered builder and checks that all its parameters
+// can be resolved. All problems found (missing or ambiguous dependencies,
+// cycles and singletons depending on scoped dependencies) are reported at
+// once in the returned error.
+func (injector Injector) Verify() error {
+	v := newVerifier(injector)
+	for name := range injector.builders {
+		v.visit(name, nil)
+	}
+	return v.result()
+}
+
+// VerifyBuilder checks that all parameters of a handler builder can be
+// resolved. Handler builders are called once per route, so they are
+// verified like singletons.
+func (injector Injector) VerifyBuilder(builder Builder) error {
+	v := newVerifier(injector)
+	v.verifyBuilder(builder, nil, Singleton, "handler builder")
+	return v.result()
+}
+
+type verifier struct {
+	injector Injector
+	done     map[reflect.Type]bool
+	seen     map[string]bool
+	errs     []error
+}
+
+func newVerifier(injector Injector) *verifier {
+	return &verifier{
+		injector: injector,
+		done:     map[reflect.Type]bool{},
+		seen:     map[string]bool{},
+	}
+}
+
+func (v *verifier) report(err error) {
+	if v.seen[err.Error()] {
+		return
+	}
+	v.seen[err.Error()] = true
+	v.errs = append(v.errs, err)
+}
+
+func (v *verifier) result() error {
+	return errors.Join(v.errs...)
+}
+
+func (v *verifier) visit(name reflect.Type, path []reflect.Type) {
+	if v.done[name] {
+		return
+	}
+	for i, visited := range path {
+		if visited == name {
+			v.report(fmt.Errorf("dependency cycle detected: %s", formatPath(append(path[i:], name))))
+			return
+		}
+	}
+	dep := v.injector.builders[name]
+	v.verifyBuilder(dep.builder, append(path, name), dep.lifetime, fmt.Sprintf("singleton %s", name))
+	v.done[name] = true
+}
+
+// verifyBuilder checks the parameters of the builder. If the builder has
+// singleton lifetime, subject is used to report its scoped dependencies.
+func (v *verifier) verifyBuilder(builder Builder, path []reflect.Type, lifetime Lifetime, subject string) {
+	builderType := reflect.TypeOf(builder)
+	if err := checkBuilderType(builderType); err != nil {
+		v.report(err)
+		return
+	}
+	for i := range builderType.NumIn() {
+		in := builderType.In(i)
+		if _, ok := v.injector.builders[in]; !ok {
+			v.report(fmt.Errorf("%s: %w", builderLocation(builder), v.missing(in)))
+			continue
+		}
+		if lifetime == Singleton {
+			if chain := v.scopedChain(in, nil); chain != nil {
+				v.report(fmt.Errorf(
+					"%s: %s cannot depend on scoped %s (%s)",
+					builderLocation(builder),
+					subject,
+					chain[len(chain)-1],
+					formatPath(chain)))
+			}
+		}
+		v.visit(in, path)
+	}
+}
+
+// scopedChain returns the path from name to a scoped dependency, following
+// transient dependencies, because they are built by whoever asks for them
+// and live as long as it. It returns nil if there is no such path.
+func (v *verifier) scopedChain(name reflect.Type, path []reflect.Type) []reflect.Type {
+	dep, ok := v.injector.builders[name]
+	if !ok || slices.Contains(path, name) {
+		return nil
+	}
+	path = append(path, name)
+	switch dep.lifetime {
+	case Scoped:
+		return path
+	case Transient:
+		builderType := reflect.TypeOf(dep.builder)
+		for i := range builderType.NumIn() {
+			if chain := v.scopedChain(builderType.In(i), path); chain != nil {
+				return chain
+			}
+		}
+	}
+	return nil
+}
+
+func (v *verifier) missing(name reflect.Type) error {
+	var candidates []string
+	if name.Kind() == reflect.Interface {
+		for registered := range v.injector.builders {
+			if registered.Implements(name) {
+				candidates = append(candidates, registered.String())
+			}
+		}
+	}
+	sort.Strings(candidates)
+	switch len(candidates) {
+	case 0:
+		return fmt.Errorf("builder not found for type %s", name)
+	case 1:
+		return fmt.Errorf("builder not found for type %s (registered type %s implements it, register it as %s)",
+			name, candidates[0], name)
+	default:
+		return fmt.Errorf("ambiguous dependency %s: no builder for it and it is implemented by %s",
+			name, strings.Join(candidates, ", "))
+	}
 }
 
 // PopulateStruct fills a struct with the implementations
@@ -107,7 +408,7 @@ func (injector Injector) PopulateStruct(userStruct interface{}) {
 	ptrStructValue := reflect.ValueOf(userStruct)
 	structValue := ptrStructValue.Elem()
 	if structValue.Kind() != reflect.Struct {
-		log.Panicln("Value passed to PopulateStruct is not a struct")
+		logging.Panic("value passed to PopulateStruct is not a struct", nil)
 	}
 	for i := range structValue.NumField() {
 		field := structValue.Field(i)
@@ -122,16 +423,84 @@ func (injector Injector) PopulateStruct(userStruct interface{}) {
 }
 
 // Run is a function that runs a Runner. Show Runner type for more information.
+// If some parameter cannot be resolved, it will panic.
 func (injector Injector) Run(runner Runner) {
-	var inputs []reflect.Value
-	runnerType := reflect.TypeOf(runner)
-	for i := range runnerType.NumIn() {
-		impl, err := injector.GetByType(runnerType.In(i))
-		if err != nil {
-			panic(err)
+	injector.run(runner, nil)
+}
+
+func (injector Injector) run(runner Runner, scope *Scope) {
+	inputs, err := injector.resolveInputs(reflect.TypeOf(runner), scope, nil)
+	if err != nil {
+		panic(err)
+	}
+	reflect.ValueOf(runner).Call(inputs)
+}
+
+// NewScope creates a Scope to resolve scoped dependencies.
+func (injector *Injector) NewScope() *Scope {
+	return &Scope{
+		injector:  injector,
+		instances: make(map[reflect.Type]interface{}),
+	}
+}
+
+// Scope holds the instances of scoped dependencies. Routers create
+// one Scope for each request.
+type Scope struct {
+	injector  *Injector
+	instances map[reflect.Type]interface{}
+	order     []reflect.Type
+	mutex     sync.Mutex
+}
+
+func (scope *Scope) get(name reflect.Type, dep *dependency, path []reflect.Type) (interface{}, error) {
+	scope.mutex.Lock()
+	instance, ok := scope.instances[name]
+	scope.mutex.Unlock()
+	if ok {
+		return instance, nil
+	}
+	// The builder is called without holding the lock because it
+	// can ask for other scoped dependencies.
+	instance, err := scope.injector.callBuilder(dep.builder, scope, path)
+	if err != nil {
+		return nil, err
+	}
+	scope.mutex.Lock()
+	defer scope.mutex.Unlock()
+	if previous, ok := scope.instances[name]; ok {
+		return previous, nil
+	}
+	scope.instances[name] = instance
+	scope.order = append(scope.order, name)
+	return instance, nil
+}
+
+// GetByType returns a builded dependency identified by type. Scoped
+// dependencies are resolved using this Scope.
+func (scope *Scope) GetByType(name reflect.Type) (interface{}, error) {
+	return scope.injector.resolve(name, scope, nil)
+}
+
+// Run a Runner resolving scoped dependencies using this Scope.
+func (scope *Scope) Run(runner Runner) {
+	scope.injector.run(runner, scope)
+}
+
+// Close closes all scoped instances that implements io.Closer, in
+// reverse creation order.
+func (scope *Scope) Close() error {
+	scope.mutex.Lock()
+	defer scope.mutex.Unlock()
+	var errs []error
+	for i := len(scope.order) - 1; i >= 0; i-- {
+		if closer, ok := scope.instances[scope.order[i]].(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
 		}
-		inputs = append(inputs, reflect.ValueOf(impl))
 	}
-	runnerVal := reflect.ValueOf(runner)
-	runnerVal.Call(inputs)
+	scope.instances = make(map[reflect.Type]interface{})
+	scope.order = nil
+	return errors.Join(errs...)
 }
@@ -4,13 +4,13 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/cypher"
+	"github.com/deltegui/phx/logging"
 )
 
 type Localizer map[string]string
@@ -43,24 +43,24 @@ func NewLocalizerStore(files embed.FS, sharedKey, errorsKey string, cypher core.
 func (ls Store) loadFile(file string) i18n {
 	raw, err := ls.files.ReadFile(file)
 	if err != nil {
-		log.Panicln("Error while reading file ", file, err)
+		logging.Panic(fmt.Sprintf("cannot read localization file '%s'", file), err)
 	}
 	var values i18n
 	if err = json.Unmarshal(raw, &values); err != nil {
-		log.Panicln("Error while decoding localization file ", file, err)
+		logging.Panic(fmt.Sprintf("cannot decode localization file '%s'", file), err)
 	}
 	return values
 }
 
 func (ls Store) GetWithoutShared(key, language string) Localizer {
-	log.Println("Loading localization with key", key)
+	logging.Logger().Debug("loading localization", "key", key)
 	key = fmt.Sprintf("%s.json", key)
 	values := ls.loadFile(key)
 	val, ok := values[language]
 	if !ok {
 		val, ok = values[fallbackLanguage]
 		if !ok {
-			log.Panicf("Failed to load fallback language ('%s') localizations for key '%s'\n", fallbackLanguage, key)
+			logging.Panic(fmt.Sprintf("failed to load fallback language ('%s') localizations for key '%s'", fallbackLanguage, key), nil)
 		}
 	}
 	return val
@@ -143,7 +143,7 @@ func CreateCookie(w http.ResponseWriter, localization string, cy core.Cypher) er
 			break
 		}
 	}
-	log.Printf("Creating language cookie for lang; '%s'", lang)
+	logging.Logger().Debug("creating language cookie", "language", lang)
 	encode, err := cypher.EncodeCookie(cy, lang)
 	if err != nil {
 		return fmt.Errorf("cannot create language cookie: %w", err)
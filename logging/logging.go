@@ -0,0 +1,57 @@
+// Package logging holds the logger used by phx to report its internal
+// events (warnings, errors handling requests, server lifecycle...). By
+// default it is slog.Default(), so it follows slog.SetDefault. It can be
+// replaced to send phx logs elsewhere:
+//
+//	logging.SetHandler(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// Logger returns the logger used by phx.
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
+
+// SetLogger replaces the logger used by phx. Use nil to go back to
+// slog.Default().
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// SetHandler replaces the logger used by phx with one that sends the
+// records to the handler.
+func SetHandler(h slog.Handler) {
+	SetLogger(slog.New(h))
+}
+
+// Panic logs the message and the error, if any, and panics. It is used for
+// errors that phx cannot recover from, like a failing random generator.
+func Panic(msg string, err error) {
+	if err == nil {
+		Logger().Error(msg)
+		panic(msg)
+	}
+	Logger().Error(msg, "error", err)
+	panic(fmt.Errorf("%s: %w", msg, err))
+}
+
+// Fatal logs the message and the error, if any, and exits with status 1.
+func Fatal(msg string, err error) {
+	if err == nil {
+		Logger().Error(msg)
+	} else {
+		Logger().Error(msg, "error", err)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/deltegui/phx"
+	"github.com/deltegui/phx/session"
+)
+
+type AccessLogFormat int
+
+const (
+	// AccessLogJson writes a JSON object per request using slog.
+	AccessLogJson AccessLogFormat = iota
+	// AccessLogText writes a key=value line per request using slog.
+	AccessLogText
+	// AccessLogCombined writes a line per request in the Combined Log
+	// Format used by Apache and nginx.
+	AccessLogCombined
+)
+
+type AccessLogOptions struct {
+	Format AccessLogFormat
+
+	// Output of the log. By default os.Stdout.
+	Output io.Writer
+
+	// Logger used for the Json and Text formats instead of creating one
+	// that writes to Output. Useful to send access logs to a custom
+	// slog.Handler.
+	Logger *slog.Logger
+}
+
+// AccessLog logs every request once it has been handled (including the
+// response sent by the ErrorHandler) with its status, bytes sent and
+// latency:
+//
+//	r.Use(middleware.AccessLog(middleware.AccessLogOptions{Format: middleware.AccessLogCombined}))
+func AccessLog(opts AccessLogOptions) phx.Middleware {
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	if opts.Format == AccessLogCombined {
+		return combinedAccessLog(output)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		if opts.Format == AccessLogText {
+			logger = slog.New(slog.NewTextHandler(output, nil))
+		} else {
+			logger = slog.New(slog.NewJSONHandler(output, nil))
+		}
+	}
+	return func(next phx.Handler) phx.Handler {
+		return func(ctx *phx.Context) error {
+			start := time.Now()
+			ctx.AfterResponse(func() {
+				attrs := []slog.Attr{
+					slog.String("method", ctx.Req.Method),
+					slog.String("uri", ctx.Req.RequestURI),
+					slog.Int("status", responseStatus(ctx)),
+					slog.Int("bytes", ctx.ResponseSize()),
+					slog.Duration("latency", time.Since(start)),
+					slog.String("remote", ctx.Req.RemoteAddr),
+					slog.String("user_agent", ctx.Req.UserAgent()),
+				}
+				if rt := ctx.Route(); rt != nil && len(rt.Pattern()) > 0 {
+					attrs = append(attrs, slog.String("route", rt.Pattern()))
+				}
+				if user, ok := ctx.Get(session.ContextKey).(session.User); ok {
+					attrs = append(attrs, slog.Int64("user", user.Id))
+				}
+				if id := ctx.RequestId(); len(id) > 0 {
+					attrs = append(attrs, slog.String("request_id", id))
+				}
+				logger.LogAttrs(ctx.Req.Context(), slog.LevelInfo, "request", attrs...)
+			})
+			return next(ctx)
+		}
+	}
+}
+
+// combinedAccessLog writes the log using the Combined Log Format:
+//
+//	127.0.0.1 - admin [10/Oct/2000:13:55:36 -0700] "GET /demo HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/5.0"
+func combinedAccessLog(output io.Writer) phx.Middleware {
+	var mutex sync.Mutex
+	return func(next phx.Handler) phx.Handler {
+		return func(ctx *phx.Context) error {
+			start := time.Now()
+			ctx.AfterResponse(func() {
+				host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+				if err != nil {
+					host = ctx.Req.RemoteAddr
+				}
+				user := "-"
+				if u, ok := ctx.Get(session.ContextKey).(session.User); ok && len(u.Name) > 0 {
+					user = u.Name
+				}
+				size := "-"
+				if ctx.ResponseSize() > 0 {
+					size = strconv.Itoa(ctx.ResponseSize())
+				}
+				mutex.Lock()
+				defer mutex.Unlock()
+				fmt.Fprintf(output, "%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+					host,
+					user,
+					start.Format("02/Jan/2006:15:04:05 -0700"),
+					ctx.Req.Method,
+					ctx.Req.RequestURI,
+					ctx.Req.Proto,
+					responseStatus(ctx),
+					size,
+					orDash(ctx.Req.Referer()),
+					orDash(ctx.Req.UserAgent()))
+			})
+			return next(ctx)
+		}
+	}
+}
+
+// responseStatus returns the sent status. If nothing have been written,
+// net/http sends a 200.
+func responseStatus(ctx *phx.Context) int {
+	if !ctx.ResponseWritten() {
+		return http.StatusOK
+	}
+	return ctx.ResponseStatus()
+}
+
+func orDash(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
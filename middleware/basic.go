@@ -1,19 +1,18 @@
 package middleware
 
 import (
-	"log"
-
 	"github.com/deltegui/phx"
 )
 
+// Logger logs every request before handling it. Use AccessLog to also log
+// the response status, size and latency.
 func Logger(next phx.Handler) phx.Handler {
 	return func(ctx *phx.Context) error {
-		log.Printf(
-			"[PHX] request from %s (%s) to (%s) %s",
-			ctx.Req.RemoteAddr,
-			ctx.Req.UserAgent(),
-			ctx.Req.Method,
-			ctx.Req.RequestURI)
+		ctx.Logger().Info(
+			"request",
+			"remote", ctx.Req.RemoteAddr,
+			"user_agent", ctx.Req.UserAgent(),
+			"uri", ctx.Req.RequestURI)
 		return next(ctx)
 	}
 }
@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/deltegui/phx"
@@ -16,8 +15,7 @@ func Csrf(cs *csrf.Csrf) phx.Middleware {
 				return next(ctx)
 			}
 			if !cs.CheckRequest(ctx.Req) {
-				ctx.Res.WriteHeader(http.StatusForbidden)
-				return errors.New("expired csrf token")
+				return phx.NewHttpError(http.StatusForbidden, "expired csrf token")
 			}
 			ctx.Set(csrf.ContextKey, cs.Generate())
 			return next(ctx)
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/deltegui/phx"
+)
+
+// PanicError is the error returned by Recover when a handler panics.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (panicErr PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", panicErr.Value)
+}
+
+// Recover converts panics into a PanicError that is sent to the router's
+// ErrorHandler (the default one responds with a generic 500). The stack
+// is logged. In dev mode, if the client accepts HTML, a page with the
+// stack, the request, the context values and the route is sent instead.
+// Never use dev mode in production.
+//
+// A middleware only recovers the panics of the handlers it wraps. Register
+// it with Use after the other global middlewares, so it covers them:
+//
+//	r.Use(middleware.Logger)
+//	r.Use(middleware.Recover(false))
+//
+// Global middlewares wrap the group and route ones, so their panics are
+// recovered too.
+func Recover(dev bool) phx.Middleware {
+	return func(next phx.Handler) phx.Handler {
+		return func(ctx *phx.Context) (err error) {
+			defer func() {
+				value := recover()
+				if value == nil {
+					return
+				}
+				if value == http.ErrAbortHandler {
+					panic(value)
+				}
+				panicErr := PanicError{
+					Value: value,
+					Stack: debug.Stack(),
+				}
+				ctx.Logger().Error("recovered from panic", "panic", fmt.Sprint(value), "stack", string(panicErr.Stack))
+				if dev && !ctx.ResponseWritten() && strings.Contains(ctx.Req.Header.Get("Accept"), "text/html") {
+					if renderErr := renderPanicPage(ctx, panicErr); renderErr != nil {
+						ctx.Logger().Error("cannot render panic page", "error", renderErr)
+					}
+				}
+				err = panicErr
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+type panicPageModel struct {
+	Error   PanicError
+	Route   string
+	Method  string
+	Url     string
+	Proto   string
+	Remote  string
+	Id      string
+	Headers [][2]string
+	Values  [][2]string
+}
+
+func renderPanicPage(ctx *phx.Context, panicErr PanicError) error {
+	model := panicPageModel{
+		Error:  panicErr,
+		Route:  "-",
+		Method: ctx.Req.Method,
+		Url:    ctx.Req.URL.String(),
+		Proto:  ctx.Req.Proto,
+		Remote: ctx.Req.RemoteAddr,
+		Id:     ctx.RequestId(),
+	}
+	if rt := ctx.Route(); rt != nil {
+		model.Route = rt.String()
+		if len(rt.Name()) > 0 && len(rt.Pattern()) > 0 {
+			model.Route = fmt.Sprintf("%s (%s)", rt, rt.Name())
+		}
+	}
+	for key, values := range ctx.Req.Header {
+		model.Headers = append(model.Headers, [2]string{key, strings.Join(values, ", ")})
+	}
+	slices.SortFunc(model.Headers, func(a, b [2]string) int {
+		return strings.Compare(a[0], b[0])
+	})
+	for _, key := range ctx.Keys() {
+		model.Values = append(model.Values, [2]string{
+			fmt.Sprintf("%v", key),
+			fmt.Sprintf("%+v", ctx.Get(key)),
+		})
+	}
+
+	var page bytes.Buffer
+	if err := panicPage.Execute(&page, model); err != nil {
+		return err
+	}
+	ctx.Res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Res.WriteHeader(http.StatusInternalServerError)
+	_, err := ctx.Res.Write(page.Bytes())
+	return err
+}
+
+var panicPage = template.Must(template.New("panic").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Panic: {{ .Error.Value }}</title>
+	<style>
+		body { font-family: sans-serif; margin: 2em; color: #222; }
+		h1 { color: #b00020; font-size: 1.5em; }
+		h2 { font-size: 1.1em; margin-top: 2em; }
+		pre { background: #f4f4f4; padding: 1em; overflow-x: auto; }
+		table { border-collapse: collapse; }
+		td { border-bottom: 1px solid #ddd; padding: 0.3em 1em 0.3em 0; vertical-align: top; }
+		td:first-child { font-weight: bold; }
+	</style>
+</head>
+<body>
+	<h1>Panic: {{ .Error.Value }}</h1>
+	<h2>Route</h2>
+	<p>{{ .Route }}</p>
+	<h2>Stack</h2>
+	<pre>{{ printf "%s" .Error.Stack }}</pre>
+	<h2>Request</h2>
+	<table>
+		<tr><td>Method</td><td>{{ .Method }}</td></tr>
+		<tr><td>URL</td><td>{{ .Url }}</td></tr>
+		<tr><td>Protocol</td><td>{{ .Proto }}</td></tr>
+		<tr><td>Remote address</td><td>{{ .Remote }}</td></tr>
+		{{ if .Id }}<tr><td>Request id</td><td>{{ .Id }}</td></tr>{{ end }}
+	</table>
+	<h2>Headers</h2>
+	<table>
+		{{ range .Headers }}<tr><td>{{ index . 0 }}</td><td>{{ index . 1 }}</td></tr>
+		{{ end }}
+	</table>
+	<h2>Context values</h2>
+	<table>
+		{{ range .Values }}<tr><td>{{ index . 0 }}</td><td>{{ index . 1 }}</td></tr>
+		{{ else }}<tr><td>No values</td></tr>
+		{{ end }}
+	</table>
+</body>
+</html>
+`))
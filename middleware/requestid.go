@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/deltegui/phx"
+	"github.com/deltegui/phx/requestid"
+)
+
+// RequestId identifies every request using the id received in the
+// X-Request-Id header or a new one if there is none (or it is not valid).
+// The id is stored in the Context (see phx.Context.RequestId), added to
+// the logs and error responses and sent back in the X-Request-Id header.
+func RequestId(next phx.Handler) phx.Handler {
+	return func(ctx *phx.Context) error {
+		id := ctx.Req.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.Generate()
+		}
+		ctx.Set(requestid.ContextKey, id)
+		ctx.Res.Header().Set(requestid.Header, id)
+		return next(ctx)
+	}
+}
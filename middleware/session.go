@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
 
 	"github.com/deltegui/phx"
@@ -12,11 +11,12 @@ import (
 func Authorize(manager *session.Manager, url string) phx.Middleware {
 	return func(next phx.Handler) phx.Handler {
 		return func(ctx *phx.Context) error {
-			user, err := manager.ReadSessionCookie(ctx.Req)
+			sess, err := manager.Authenticate(ctx.Res, ctx.Req)
 			if err != nil {
 				handleError(ctx, url)
-				return err
+				return nil
 			}
+			user := sess.User()
 			ctx.Set(session.ContextKey, user)
 			return next(ctx)
 		}
@@ -26,11 +26,12 @@ func Authorize(manager *session.Manager, url string) phx.Middleware {
 func AuthorizeRoles(manager *session.Manager, url string, roles []core.Role) phx.Middleware {
 	return func(next phx.Handler) phx.Handler {
 		return func(ctx *phx.Context) error {
-			user, err := manager.ReadSessionCookie(ctx.Req)
+			sess, err := manager.Authenticate(ctx.Res, ctx.Req)
 			if err != nil {
 				handleError(ctx, url)
-				return err
+				return nil
 			}
+			user := sess.User()
 			for _, authorizedRol := range roles {
 				if user.Role == authorizedRol {
 					return next(ctx)
@@ -45,14 +46,15 @@ func AuthorizeRoles(manager *session.Manager, url string, roles []core.Role) phx
 func Admin(manager *session.Manager, url string) phx.Middleware {
 	return func(next phx.Handler) phx.Handler {
 		return func(ctx *phx.Context) error {
-			user, err := manager.ReadSessionCookie(ctx.Req)
+			sess, err := manager.Authenticate(ctx.Res, ctx.Req)
 			if err != nil {
 				handleError(ctx, url)
-				return err
+				return nil
 			}
+			user := sess.User()
 			if user.Role != core.RoleAdmin {
 				handleError(ctx, url)
-				return err
+				return nil
 			}
 			ctx.Set(session.ContextKey, user)
 			return next(ctx)
@@ -63,9 +65,9 @@ func Admin(manager *session.Manager, url string) phx.Middleware {
 func handleError(ctx *phx.Context, url string) {
 	if len(url) > 0 {
 		http.Redirect(ctx.Res, ctx.Req, url, http.StatusTemporaryRedirect)
-		log.Printf("Authentication failed. Redirecting to url: %s", url)
+		ctx.Logger().Info("authentication failed", "redirect", url)
 	} else {
 		ctx.Res.WriteHeader(http.StatusUnauthorized)
-		log.Println("Authentication failed")
+		ctx.Logger().Info("authentication failed")
 	}
 }
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/deltegui/phx"
+)
+
+// Timeout cancels the request's context after the duration. If the handler
+// does not write anything before the deadline a context.DeadlineExceeded
+// error is returned, so the ErrorHandler sends a 503.
+func Timeout(duration time.Duration) phx.Middleware {
+	return func(next phx.Handler) phx.Handler {
+		return func(ctx *phx.Context) error {
+			timeout, cancel := context.WithTimeout(ctx.Req.Context(), duration)
+			defer cancel()
+			ctx.WithContext(timeout)
+			err := next(ctx)
+			if err == nil && !ctx.ResponseWritten() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
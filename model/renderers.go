@@ -2,11 +2,12 @@ package model
 
 import (
 	"fmt"
-	"log"
+	"slices"
 
 	"github.com/deltegui/phx"
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/localizer"
+	"github.com/deltegui/phx/logging"
 )
 
 type ViewModel struct {
@@ -34,6 +35,26 @@ func CreateViewModel(ctx *phx.Context, name string, model interface{}) ViewModel
 	}
 }
 
+// Flashes returns the messages stored with Context.Flash, localized using
+// the view localization. They are consumed the first time they are read
+// in the request, so only templates that show them consume them.
+func (vm ViewModel) Flashes() []phx.Flash {
+	if vm.Ctx == nil {
+		return nil
+	}
+	flashes := slices.Clone(vm.Ctx.Flashes())
+	if vm.Localizer != nil {
+		for i := range flashes {
+			flashes[i].Message = vm.Localize(flashes[i].Message)
+		}
+	}
+	return flashes
+}
+
+func (vm ViewModel) HaveFlashes() bool {
+	return len(vm.Flashes()) > 0
+}
+
 func (vm ViewModel) Localize(key string) string {
 	return vm.Localizer.Get(key)
 }
@@ -61,11 +82,9 @@ func (vm ViewModel) GetFormError(key string) string {
 }
 
 func (vm ViewModel) formatError(key string, err core.ValidationError) string {
-	log.Println("Error:", err)
 	locVal := vm.Localize(err.GetName())
-	log.Println("locVal format error", locVal)
 	finalVal := err.Format(locVal)
-	log.Println(finalVal)
+	logging.Logger().Debug("formatting validation error", "error", err, "localized", locVal, "formatted", finalVal)
 	locKey := vm.Localize(key)
 	return fmt.Sprintf(finalVal, locKey)
 }
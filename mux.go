@@ -1,21 +1,23 @@
 package phx
 
 import (
-	"context"
 	"embed"
+	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"net/http"
 	"os"
-	"os/signal"
+	"path"
 	"reflect"
-	"syscall"
-	"time"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/localizer"
+	"github.com/deltegui/phx/logging"
 	"github.com/deltegui/phx/validator"
 )
 
@@ -38,6 +40,27 @@ type Router struct {
 
 	locstore *localizer.Store
 	validate core.Validator
+
+	errorMappers   []ErrorMapper
+	errorTemplates map[int]string
+
+	routes []*Route
+	names  map[string]*Route
+
+	notFound         *fallback
+	methodNotAllowed *fallback
+	static           http.FileSystem
+	staticServer     http.Handler
+
+	startHooks    []func()
+	shutdownHooks []func()
+	hooksMutex    sync.Mutex
+	formOptions   FormOptions
+	converters    map[reflect.Type]reflect.Value
+
+	// Only set for routers created with Group.
+	parent *Router
+	prefix string
 }
 
 func (r *Router) UseLocalization(files embed.FS, sharedKey, errorsKey string) {
@@ -54,12 +77,117 @@ func (r *Router) UseLocalization(files embed.FS, sharedKey, errorsKey string) {
 	r.locstore = &loc
 }
 
+// Static serves the files of the directory for the requests that do not
+// match any route. If the file does not exist, the NotFound handler is used.
 func (r *Router) Static(path string) {
-	r.router.NotFound = http.FileServer(http.Dir(path))
+	r.serveStatic(http.Dir(path))
 }
 
+// StaticEmbedded is like Static, but serves the files of an embedded
+// filesystem.
 func (r *Router) StaticEmbedded(fs embed.FS) {
-	r.router.NotFound = http.FileServer(http.FS(fs))
+	r.serveStatic(http.FS(fs))
+}
+
+func (r *Router) serveStatic(fs http.FileSystem) {
+	if r.parent != nil {
+		r.parent.serveStatic(fs)
+		return
+	}
+	r.static = fs
+	r.staticServer = http.FileServer(fs)
+	r.router.NotFound = http.HandlerFunc(r.serveNotFound)
+}
+
+// fallback is a handler used when no route matches the request.
+type fallback struct {
+	route   *Route
+	handler Handler
+}
+
+// NotFound sets the handler used when the request does not match any
+// route nor static file. The handler receives a full Context, so it can
+// render templates or use localization. The global middlewares registered
+// before calling NotFound are applied:
+//
+//	r.NotFound(func() phx.Handler {
+//		return func(ctx *phx.Context) error {
+//			return ctx.Render(http.StatusNotFound, views.NotFound, nil)
+//		}
+//	})
+//
+// By default, a plain text 404 is sent.
+func (r *Router) NotFound(builder Builder, middlewares ...Middleware) {
+	if r.parent != nil {
+		r.parent.NotFound(builder, slices.Concat(middlewares, r.middlewares)...)
+		return
+	}
+	r.notFound = r.newFallback("NotFound", builder, middlewares)
+	r.router.NotFound = http.HandlerFunc(r.serveNotFound)
+}
+
+// MethodNotAllowed sets the handler used when the request path matches a
+// route, but not its method. The Allow header is set before calling it.
+// Like NotFound, global middlewares registered before are applied.
+func (r *Router) MethodNotAllowed(builder Builder, middlewares ...Middleware) {
+	if r.parent != nil {
+		r.parent.MethodNotAllowed(builder, slices.Concat(middlewares, r.middlewares)...)
+		return
+	}
+	r.methodNotAllowed = r.newFallback("MethodNotAllowed", builder, middlewares)
+	r.router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serve(r.methodNotAllowed.route, r.methodNotAllowed.handler, w, req, nil)
+	})
+}
+
+func (r *Router) newFallback(name string, builder Builder, middlewares []Middleware) *fallback {
+	rt := &Route{
+		router:      r,
+		name:        name,
+		builder:     builder,
+		middlewares: middlewareNames(slices.Concat(middlewares, r.middlewares)),
+	}
+	return &fallback{
+		route:   rt,
+		handler: r.chain(rt, middlewares),
+	}
+}
+
+func (r *Router) serveNotFound(w http.ResponseWriter, req *http.Request) {
+	if r.static != nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		staticFileExists(r.static, req.URL.Path) {
+		r.staticServer.ServeHTTP(w, req)
+		return
+	}
+	if r.notFound == nil {
+		http.NotFound(w, req)
+		return
+	}
+	r.serve(r.notFound.route, r.notFound.handler, w, req, nil)
+}
+
+// staticFileExists checks if a file (or a directory with an index.html)
+// exists in the filesystem.
+func staticFileExists(fs http.FileSystem, name string) bool {
+	name = path.Clean("/" + name)
+	file, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		return true
+	}
+	index, err := fs.Open(path.Join(name, "index.html"))
+	if err != nil {
+		return false
+	}
+	index.Close()
+	return true
 }
 
 func (r *Router) StaticMount(url, path string) {
@@ -70,65 +198,97 @@ func (r *Router) StaticMountEmbedded(url string, fs embed.FS) {
 	r.router.ServeFiles(fmt.Sprintf("%s/*filepath", url), http.FS(fs))
 }
 
-func defaultErrorHandler(ctx *Context, err error) {
-	log.Println("[PHX] Error:", err)
-	ctx.InternalServerError(err.Error())
-}
-
 func NewRouter() *Router {
-	return &Router{
-		injector:     NewInjector(),
-		router:       httprouter.New(),
-		middlewares:  []Middleware{},
-		ErrorHandler: defaultErrorHandler,
-		validate:     validator.New(),
+	r := &Router{
+		injector:       NewInjector(),
+		router:         httprouter.New(),
+		middlewares:    []Middleware{},
+		validate:       validator.New(),
+		errorMappers:   defaultErrorMappers(),
+		errorTemplates: map[int]string{},
+		formOptions:    defaultFormOptions(),
+		converters:     map[reflect.Type]reflect.Value{},
+		names:          map[string]*Route{},
 	}
+	r.ErrorHandler = r.DefaultErrorHandler
+	return r
 }
 
 func NewRouterFromOther(r *Router) *Router {
+	other := &Router{
+		injector:       r.injector,
+		router:         httprouter.New(),
+		middlewares:    r.middlewares,
+		locstore:       r.locstore,
+		validate:       r.validate,
+		errorMappers:   slices.Clone(r.errorMappers),
+		errorTemplates: maps.Clone(r.errorTemplates),
+		formOptions:    r.formOptions,
+		converters:     maps.Clone(r.converters),
+		names:          map[string]*Route{},
+	}
+	// The default handler is bound to the router that created it, so it
+	// would use the mappers and templates of r instead of the ones
+	// registered in other. Custom handlers are kept.
+	other.ErrorHandler = other.DefaultErrorHandler
+	if !isDefaultErrorHandler(r.ErrorHandler) {
+		other.ErrorHandler = r.ErrorHandler
+	}
+	return other
+}
+
+// Group creates a sub-router that registers its routes in the parent router
+// prepending the prefix to every pattern. The group middlewares are chained
+// after the parent ones. Requests are always served by the root router, so
+// the error handler and localization of the root router are used. Groups can
+// be nested:
+//
+//	admin := r.Group("/admin", auth.Admin())
+//	admin.Get("/users", handlers.ListUsers)
+//	reports := admin.Group("/reports")
+//	reports.Get("/:id", handlers.ShowReport) // GET /admin/reports/:id
+func (r *Router) Group(prefix string, middlewares ...Middleware) *Router {
 	return &Router{
-		injector:     r.injector,
-		router:       httprouter.New(),
-		ErrorHandler: r.ErrorHandler,
-		middlewares:  r.middlewares,
-		locstore:     r.locstore,
-		validate:     r.validate,
+		injector:    r.injector,
+		router:      r.router,
+		middlewares: middlewares,
+		parent:      r,
+		prefix:      strings.TrimSuffix(prefix, "/"),
 	}
 }
 
 func (r *Router) createContext(w http.ResponseWriter, req *http.Request, params httprouter.Params) *Context {
+	rw := newResponseWriter(w)
 	ctx := &Context{
-		Req:      req,
-		Res:      w,
-		params:   params,
-		locstore: r.locstore,
-		validate: r.validate,
-		ctx:      context.Background(),
+		Req:         req,
+		Res:         rw,
+		rw:          rw,
+		params:      params,
+		locstore:    r.locstore,
+		validate:    r.validate,
+		formOptions: r.formOptions,
+		converters:  r.converters,
+		scope:       r.injector.NewScope(),
+		router:      r,
 	}
 
 	var rend Renderer
-	instance, err := r.injector.GetByType(reflect.TypeOf(&rend).Elem())
-	if err != nil {
-		return ctx
-	}
-	rend, ok := instance.(Renderer)
-	if !ok {
-		log.Println("Expected injetor's registered renderer to be of type 'Renderer', but it is other type")
-		return ctx
+	if instance, err := ctx.scope.GetByType(reflect.TypeOf(&rend).Elem()); err == nil {
+		if rend, ok := instance.(Renderer); ok {
+			ctx.renderer = rend
+		} else {
+			logging.Logger().Error("the registered phx.Renderer dependency does not implement phx.Renderer", "type", fmt.Sprintf("%T", instance))
+		}
 	}
-	ctx.renderer = rend
 
 	var cy core.Cypher
-	cyInstance, err := r.injector.GetByType(reflect.TypeOf(&cy).Elem())
-	if err != nil {
-		return ctx
-	}
-	cy, ok = cyInstance.(core.Cypher)
-	if !ok {
-		log.Println("Expected injetor's registered cypher to be of type 'core.Cypher', but it is other type")
-		return ctx
+	if instance, err := ctx.scope.GetByType(reflect.TypeOf(&cy).Elem()); err == nil {
+		if cy, ok := instance.(core.Cypher); ok {
+			ctx.cy = cy
+		} else {
+			logging.Logger().Error("the registered core.Cypher dependency does not implement core.Cypher", "type", fmt.Sprintf("%T", instance))
+		}
 	}
-	ctx.cy = cy
 
 	return ctx
 }
@@ -137,10 +297,27 @@ func (r *Router) Add(builder Builder) {
 	r.injector.Add(builder)
 }
 
+func (r *Router) AddTransient(builder Builder) {
+	r.injector.AddTransient(builder)
+}
+
+func (r *Router) AddSingleton(builder Builder) {
+	r.injector.AddSingleton(builder)
+}
+
+func (r *Router) AddScoped(builder Builder) {
+	r.injector.AddScoped(builder)
+}
+
 func (r *Router) Run(runner Runner) {
 	r.injector.Run(runner)
 }
 
+// GetByType returns a dependency registered in the router's injector.
+func (r *Router) GetByType(name reflect.Type) (interface{}, error) {
+	return r.injector.GetByType(name)
+}
+
 func (r *Router) ShowAvailableBuilders() {
 	r.injector.ShowAvailableBuilders()
 }
@@ -153,50 +330,148 @@ func (r *Router) Use(middleware Middleware) {
 	r.middlewares = append(r.middlewares, middleware)
 }
 
-func (r *Router) Handle(method, pattern string, builder Builder, middlewares ...Middleware) {
-	h := r.injector.ResolveHandler(builder)
-	for _, m := range r.middlewares {
-		h = m(h)
+func (r *Router) Handle(method, pattern string, builder Builder, middlewares ...Middleware) *Route {
+	if r.parent != nil {
+		return r.parent.Handle(method, r.prefix+pattern, builder, slices.Concat(middlewares, r.middlewares)...)
+	}
+	rt := &Route{
+		router:      r,
+		method:      method,
+		pattern:     pattern,
+		builder:     builder,
+		middlewares: middlewareNames(slices.Concat(middlewares, r.middlewares)),
+	}
+	r.routes = append(r.routes, rt)
+	h := r.chain(rt, middlewares)
+	r.router.Handle(method, pattern, func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		r.serve(rt, h, w, req, params)
+	})
+	return rt
+}
+
+// chain builds the handler of the route wrapped by the provided middlewares
+// (the route ones followed by the ones of its groups) and then by the global
+// ones, so global middlewares run first.
+func (r *Router) chain(rt *Route, middlewares []Middleware) Handler {
+	var h Handler = func(ctx *Context) error {
+		handler, err := r.resolveHandler(rt)
+		if err != nil {
+			return err
+		}
+		return handler(ctx)
 	}
 	for _, m := range middlewares {
 		h = m(h)
 	}
-	r.router.Handle(method, pattern, func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
-		ctx := r.createContext(w, req, params)
-		h(ctx)
+	for _, m := range r.middlewares {
+		h = m(h)
+	}
+	return h
+}
+
+func (r *Router) serve(rt *Route, h Handler, w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	ctx := r.createContext(w, req, params)
+	ctx.route = rt
+	defer ctx.close()
+	if err := h(ctx); err != nil {
+		r.ErrorHandler(ctx, err)
+	}
+}
+
+func (r *Router) buildHandler(rt *Route) (Handler, error) {
+	instance, err := r.injector.Build(rt.builder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build handler for route %s: %w", rt, err)
+	}
+	h, ok := instance.(Handler)
+	if !ok {
+		return nil, fmt.Errorf("builder for route %s must return phx.Handler, got %T", rt, instance)
+	}
+	return h, nil
+}
+
+// resolveHandler builds the route handler the first time it is needed,
+// by Validate or by the first request, so the dependencies of a route can
+// be registered after it. If the build fails, the error is returned every
+// time and sent to the ErrorHandler by the requests.
+func (r *Router) resolveHandler(rt *Route) (Handler, error) {
+	rt.buildOnce.Do(func() {
+		rt.handler, rt.buildErr = r.buildHandler(rt)
 	})
+	return rt.handler, rt.buildErr
 }
 
-func (r *Router) Get(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodGet, pattern, builder, middlewares...)
+// Validate checks that all registered builders and route handler builders
+// can be resolved, and builds the route handlers, so the first requests do
+// not have to. All problems are reported at once in the returned error.
+// Listen and Server.Start call it before serving. Routers served without
+// it (for example, with ServeHTTP) build each handler on its first request
+// and send the build errors to the ErrorHandler.
+func (r *Router) Validate() error {
+	if r.parent != nil {
+		return r.parent.Validate()
+	}
+	errs := []error{r.injector.Verify()}
+	handlerType := reflect.TypeOf((*Handler)(nil)).Elem()
+	routes := slices.Clone(r.routes)
+	for _, fb := range []*fallback{r.notFound, r.methodNotAllowed} {
+		if fb != nil {
+			routes = append(routes, fb.route)
+		}
+	}
+	for _, rt := range routes {
+		builderType := reflect.TypeOf(rt.builder)
+		if builderType == nil || builderType.Kind() != reflect.Func || builderType.NumOut() == 0 ||
+			builderType.Out(0) != handlerType {
+			errs = append(errs, fmt.Errorf("builder for route %s must return phx.Handler", rt))
+			continue
+		}
+		if err := r.injector.VerifyBuilder(rt.builder); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", rt, err))
+			continue
+		}
+		if _, err := r.resolveHandler(rt); err != nil {
+			errs = append(errs, err)
+		}
+		if rt.doc.Request != nil {
+			if err := checkFormType(reflect.TypeOf(rt.doc.Request)); err != nil {
+				errs = append(errs, fmt.Errorf("route %s: request type: %w", rt, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func (r *Router) Post(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodPost, pattern, builder, middlewares...)
+func (r *Router) Get(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodGet, pattern, builder, middlewares...)
 }
 
-func (r *Router) Patch(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodPatch, pattern, builder, middlewares...)
+func (r *Router) Post(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodPost, pattern, builder, middlewares...)
 }
 
-func (r *Router) Delete(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodDelete, pattern, builder, middlewares...)
+func (r *Router) Patch(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodPatch, pattern, builder, middlewares...)
 }
 
-func (r *Router) Head(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodHead, pattern, builder, middlewares...)
+func (r *Router) Delete(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodDelete, pattern, builder, middlewares...)
 }
 
-func (r *Router) Options(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodOptions, pattern, builder, middlewares...)
+func (r *Router) Head(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodHead, pattern, builder, middlewares...)
 }
 
-func (r *Router) Put(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodPut, pattern, builder, middlewares...)
+func (r *Router) Options(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodOptions, pattern, builder, middlewares...)
 }
 
-func (r *Router) Trace(pattern string, builder Builder, middlewares ...Middleware) {
-	r.Handle(http.MethodTrace, pattern, builder, middlewares...)
+func (r *Router) Put(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodPut, pattern, builder, middlewares...)
+}
+
+func (r *Router) Trace(pattern string, builder Builder, middlewares ...Middleware) *Route {
+	return r.Handle(http.MethodTrace, pattern, builder, middlewares...)
 }
 
 // PrintLogo takes a file path and prints your fancy ascii logo.
@@ -204,7 +479,7 @@ func (r *Router) Trace(pattern string, builder Builder, middlewares ...Middlewar
 func PrintLogo(logoFile string) {
 	logo, err := os.ReadFile(logoFile)
 	if err != nil {
-		log.Fatalf("Cannot read logo file: %s\n", err)
+		logging.Fatal("cannot read logo file", err)
 	}
 	fmt.Println(string(logo))
 }
@@ -214,47 +489,82 @@ func PrintLogo(logoFile string) {
 func PrintLogoEmbedded(fs embed.FS, path string) {
 	logo, err := fs.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Cannot read logo file: %s\n", err)
+		logging.Fatal("cannot read logo file", err)
 	}
 	fmt.Println(string(logo))
 }
 
-func startServer(server *http.Server) {
-	log.Println("Listening on address: ", server.Addr)
-	log.Println("You are ready to GO!")
-	err := server.ListenAndServe()
-	if err != nil {
-		log.Fatalln("Error while listening: ", err)
+// OnStart registers a function that is called when a Server created by
+// the router starts, before serving requests, to start resources like
+// background goroutines. Release them with OnShutdown.
+func (r *Router) OnStart(hook func()) {
+	if r.parent != nil {
+		r.parent.OnStart(hook)
+		return
 	}
+	r.hooksMutex.Lock()
+	defer r.hooksMutex.Unlock()
+	r.startHooks = append(r.startHooks, hook)
 }
 
-func waitAndStopServer(server *http.Server) {
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-done
-
-	log.Print("Server Stopped")
-	const maxTiemout = 5 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), maxTiemout)
+// OnShutdown registers a function that is called when a Server created by
+// the router is stopped, to release resources like background goroutines.
+// Server.Stop waits for the hooks before returning.
+func (r *Router) OnShutdown(hook func()) {
+	if r.parent != nil {
+		r.parent.OnShutdown(hook)
+		return
+	}
+	r.hooksMutex.Lock()
+	defer r.hooksMutex.Unlock()
+	r.shutdownHooks = append(r.shutdownHooks, hook)
+}
 
-	defer func() {
-		cancel()
-	}()
+// runStartHooks calls the hooks registered with OnStart.
+func (r *Router) runStartHooks() {
+	if r.parent != nil {
+		r.parent.runStartHooks()
+		return
+	}
+	r.hooksMutex.Lock()
+	hooks := slices.Clone(r.startHooks)
+	r.hooksMutex.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server shutdown failed:%+v", err)
+// runShutdownHooks calls the hooks registered with OnShutdown.
+func (r *Router) runShutdownHooks() {
+	if r.parent != nil {
+		r.parent.runShutdownHooks()
+		return
 	}
+	r.hooksMutex.Lock()
+	hooks := slices.Clone(r.shutdownHooks)
+	r.hooksMutex.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
 
-	log.Print("Server exited properly")
+// ServeHTTP makes Router an http.Handler, so it can be used with httptest,
+// mounted inside other muxes or wrapped by stdlib middlewares.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.router.ServeHTTP(w, req)
 }
 
-func (r Router) Listen(address string) {
-	server := http.Server{
-		Addr:    address,
-		Handler: r.router,
+// Listen validates the router and serves it in the provided address until
+// the process receives an interrupt signal. Use Server to configure it.
+func (r *Router) Listen(address string) {
+	if err := r.Validate(); err != nil {
+		logging.Logger().Error("invalid dependency configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := r.Server(ServerOptions{Addr: address}).Run(); err != nil {
+		logging.Logger().Error("error while listening", "error", err)
+		os.Exit(1)
 	}
-	go startServer(&server)
-	waitAndStopServer(&server)
 }
 
 func Redirect(to string) func() Handler {
@@ -0,0 +1,269 @@
+// Package openapi generates OpenAPI 3.1 documents from the routes
+// registered in a phx.Router. Routes are described using phx.RouteDoc:
+//
+//	r.Post("/api/users/:id", handlers.UpdateUser).Doc(phx.RouteDoc{
+//		Summary:   "Updates a user",
+//		Request:   UpdateUserRequest{},
+//		Responses: map[int]any{http.StatusOK: UserResponse{}},
+//	})
+//
+//	docs := openapi.New(openapi.Info{Title: "My API", Version: "1.0.0"})
+//	docs.Serve(r, "/openapi.json")
+//
+// Paths, path params, request and response schemas (from json and valtruc
+// tags), params read by phx.Context.Bind (path, query, header and cookie
+// tags) and security requirements (from the middlewares of each route) are
+// added to the document.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deltegui/phx"
+	"github.com/deltegui/phx/middleware"
+	"github.com/deltegui/phx/session"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version string = "3.1.0"
+
+// SessionScheme is the name of the security scheme of the phx session
+// cookie. It is registered by default and required by the routes that use
+// middleware.Authorize, middleware.AuthorizeRoles or middleware.Admin.
+const SessionScheme string = "session"
+
+// Generator creates OpenAPI documents.
+type Generator struct {
+	info     Info
+	servers  []Server
+	schemes  map[string]SecurityScheme
+	matchers []securityMatcher
+}
+
+type securityMatcher struct {
+	scheme string
+	name   string
+}
+
+func New(info Info) *Generator {
+	g := &Generator{
+		info:    info,
+		schemes: map[string]SecurityScheme{},
+	}
+	g.Security(
+		SessionScheme,
+		SecurityScheme{Type: "apiKey", In: "cookie", Name: session.CookieName},
+		middleware.Authorize,
+		middleware.AuthorizeRoles,
+		middleware.Admin)
+	return g
+}
+
+// Security registers a security scheme required by the routes that are
+// wrapped by a middleware created by any of the constructors. A constructor
+// can be a phx.Middleware or a function that returns one (middleware.Authorize,
+// for example):
+//
+//	docs.Security("apiKey", openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-Api-Key"}, RequireApiKey)
+func (g *Generator) Security(name string, scheme SecurityScheme, constructors ...any) {
+	g.schemes[name] = scheme
+	for _, constructor := range constructors {
+		g.matchers = append(g.matchers, securityMatcher{
+			scheme: name,
+			name:   funcName(constructor),
+		})
+	}
+}
+
+func (g *Generator) AddServer(url, description string) {
+	g.servers = append(g.servers, Server{Url: url, Description: description})
+}
+
+// Generate creates the document for all the routes of the router that are
+// not hidden.
+func (g *Generator) Generate(r *phx.Router) *Document {
+	s := newSchemas()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    g.info,
+		Servers: g.servers,
+		Paths:   map[string]PathItem{},
+	}
+	for _, rt := range r.Routes() {
+		if rt.Doc.Hidden {
+			continue
+		}
+		path, params := translatePath(rt.Pattern)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = g.operation(s, rt, params)
+	}
+	doc.Components = &Components{
+		Schemas:         s.defs,
+		SecuritySchemes: g.schemes,
+	}
+	return doc
+}
+
+// WriteFile writes the document of the router as JSON to path.
+func (g *Generator) WriteFile(r *phx.Router, path string) error {
+	encoded, err := json.MarshalIndent(g.Generate(r), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, encoded, 0o644)
+}
+
+// Serve registers a GET route at url that responds with the document of
+// the router. The route itself is not documented.
+func (g *Generator) Serve(r *phx.Router, url string) *phx.Route {
+	return r.Get(url, func() phx.Handler {
+		return func(ctx *phx.Context) error {
+			return ctx.JsonOk(g.Generate(r))
+		}
+	}).Doc(phx.RouteDoc{Hidden: true})
+}
+
+// translatePath converts an httprouter pattern to an OpenAPI path and
+// returns the names of its params. "/users/:id/*file" is translated to
+// "/users/{id}/{file}".
+func translatePath(pattern string) (string, []string) {
+	segments := strings.Split(pattern, "/")
+	params := []string{}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (g *Generator) operation(s *schemas, rt phx.RouteInfo, pathParams []string) *Operation {
+	op := &Operation{
+		OperationId: rt.Name,
+		Summary:     rt.Doc.Summary,
+		Description: rt.Doc.Description,
+		Tags:        rt.Doc.Tags,
+		Deprecated:  rt.Doc.Deprecated,
+		Responses:   map[string]Response{},
+	}
+	if rt.Doc.Request != nil {
+		t := reflect.TypeOf(rt.Doc.Request)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		op.Parameters = parameters(s, t)
+		if hasBody(rt.Method) && (t.Kind() != reflect.Struct || len(s.object(t).Properties) > 0) {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: s.of(t)}},
+			}
+		}
+	}
+	for _, name := range pathParams {
+		if !slices.ContainsFunc(op.Parameters, func(p Parameter) bool { return p.In == "path" && p.Name == name }) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	for status, body := range rt.Doc.Responses {
+		res := Response{Description: http.StatusText(status)}
+		if body != nil {
+			res.Content = map[string]MediaType{"application/json": {Schema: s.of(reflect.TypeOf(body))}}
+		}
+		op.Responses[strconv.Itoa(status)] = res
+	}
+	if len(op.Responses) == 0 {
+		op.Responses[strconv.Itoa(http.StatusOK)] = Response{Description: http.StatusText(http.StatusOK)}
+	}
+	op.Responses["default"] = Response{
+		Description: "Error",
+		Content:     map[string]MediaType{"application/json": {Schema: s.of(reflect.TypeOf(phx.ErrorModel{}))}},
+	}
+	op.Security = g.security(rt.Middlewares)
+	return op
+}
+
+func hasBody(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodDelete
+}
+
+// parameters returns the params of the request read by phx.Context.Bind
+// from the path, query, headers and cookies.
+func parameters(s *schemas, t reflect.Type) []Parameter {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	params := []Parameter{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		if field.Anonymous && !isParam(field) {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			params = append(params, parameters(s, embedded)...)
+			continue
+		}
+		for _, in := range paramTags {
+			name, ok := field.Tag.Lookup(in)
+			if !ok || name == "-" {
+				continue
+			}
+			schema := s.of(field.Type)
+			required := applyRules(schema, field)
+			params = append(params, Parameter{
+				Name:     name,
+				In:       in,
+				Required: required || in == "path",
+				Schema:   schema,
+			})
+		}
+	}
+	return params
+}
+
+func (g *Generator) security(middlewares []string) []map[string][]string {
+	var requirements []map[string][]string
+	for _, name := range middlewares {
+		for _, matcher := range g.matchers {
+			if name != matcher.name && !strings.HasPrefix(name, matcher.name+".func") {
+				continue
+			}
+			requirement := map[string][]string{matcher.scheme: {}}
+			if !slices.ContainsFunc(requirements, func(r map[string][]string) bool {
+				_, ok := r[matcher.scheme]
+				return ok
+			}) {
+				requirements = append(requirements, requirement)
+			}
+		}
+	}
+	return requirements
+}
+
+func funcName(fn any) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return ""
+	}
+	return f.Name()
+}
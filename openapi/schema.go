@@ -0,0 +1,214 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deltegui/phx"
+)
+
+// paramTags are the tags used by phx.Context.Bind to read values from
+// other parts of the request than the body.
+var paramTags = []string{"path", "query", "header", "cookie"}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	uploadType          = reflect.TypeOf(phx.Upload{})
+	fileHeaderType      = reflect.TypeOf(multipart.FileHeader{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	invalidNameCharsExp = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+// schemas creates the JSON schemas of Go types. Named structs are stored
+// as components and referenced.
+type schemas struct {
+	defs  map[string]*Schema
+	names map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		defs:  map[string]*Schema{},
+		names: map[reflect.Type]string{},
+	}
+}
+
+func (s *schemas) of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uploadType, fileHeaderType:
+		return &Schema{Type: "string", Format: "binary"}
+	case rawMessageType:
+		return &Schema{}
+	}
+	if t.Kind() != reflect.Struct && reflect.PointerTo(t).Implements(textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	default:
+		return &Schema{}
+	}
+}
+
+// component registers the schema of a named struct and returns its name.
+func (s *schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := invalidNameCharsExp.ReplaceAllString(t.Name(), "_")
+	if s.defs[name] != nil {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = invalidNameCharsExp.ReplaceAllString(pkg+"."+t.Name(), "_")
+	}
+	base := name
+	for i := 2; s.defs[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	s.names[t] = name
+	s.defs[name] = &Schema{}
+	*s.defs[name] = *s.object(t)
+	return name
+}
+
+// object creates the schema of the fields of a struct encoded in the
+// body, using the same rules as encoding/json. Fields read from the path,
+// query, headers or cookies are not part of the body.
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{},
+	}
+	s.addFields(schema, t)
+	return schema
+}
+
+func (s *schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isParam(field) {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && len(name) == 0 {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		property := s.of(field.Type)
+		if applyRules(property, field) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+func isParam(field reflect.StructField) bool {
+	for _, tag := range paramTags {
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules adds the valtruc rules of the field to its schema and returns
+// if the field is required. Only the rules that have an equivalent in JSON
+// schema are used.
+func applyRules(schema *Schema, field reflect.StructField) bool {
+	required := false
+	t := field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, rule := range strings.Split(field.Tag.Get("valtruc"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			applyLimit(schema, t.Kind(), key == "min", n)
+		}
+	}
+	return required
+}
+
+func applyLimit(schema *Schema, kind reflect.Kind, isMin bool, n float64) {
+	length := int(n)
+	switch kind {
+	case reflect.String:
+		if isMin {
+			schema.MinLength = &length
+		} else {
+			schema.MaxLength = &length
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if isMin {
+			schema.MinItems = &length
+		} else {
+			schema.MaxItems = &length
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if isMin {
+			schema.Minimum = &n
+		} else {
+			schema.Maximum = &n
+		}
+	}
+}
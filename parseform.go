@@ -1,20 +1,88 @@
 package phx
 
 import (
+	"encoding"
+	"fmt"
+	"mime/multipart"
+	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/validator"
 )
 
-const multipartFormMaxSize = 64 << 20 // 20MB
+const multipartFormMaxSize = 64 << 20 // 64MB
+
+const (
+	defaultFormMaxDepth    int = 8
+	defaultFormMaxElements int = 1000
+)
+
+// FormOptions limits how deep and how big the structures filled by
+// ParseForm can be, to avoid abuse.
+type FormOptions struct {
+	// Maximum nesting of structs, slices, arrays and maps. By default 8.
+	MaxDepth int
+	// Maximum number of elements of all slices, arrays and maps filled
+	// in a single ParseForm call, and maximum index that can be set.
+	// By default 1000.
+	MaxElements int
+}
+
+func defaultFormOptions() FormOptions {
+	return FormOptions{
+		MaxDepth:    defaultFormMaxDepth,
+		MaxElements: defaultFormMaxElements,
+	}
+}
+
+// SetFormOptions changes the limits used by ParseForm. Zero values
+// keep the defaults.
+func (r *Router) SetFormOptions(opts FormOptions) {
+	if r.parent != nil {
+		r.parent.SetFormOptions(opts)
+		return
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultFormMaxDepth
+	}
+	if opts.MaxElements <= 0 {
+		opts.MaxElements = defaultFormMaxElements
+	}
+	r.formOptions = opts
+}
+
+// AddConverter registers a function to convert form values (and path,
+// query, header or cookie values used by Bind) to a type. It must have
+// the shape func(string) (T, error):
+//
+//	r.AddConverter(uuid.Parse)
+//	r.AddConverter(func(s string) (core.Role, error) { ... })
+//
+// Converters take precedence over encoding.TextUnmarshaler and the
+// default conversions.
+func (r *Router) AddConverter(converter any) {
+	if r.parent != nil {
+		r.parent.AddConverter(converter)
+		return
+	}
+	t := reflect.TypeOf(converter)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 1 || t.In(0).Kind() != reflect.String ||
+		t.NumOut() != 2 || t.Out(1) != reflect.TypeOf((*error)(nil)).Elem() {
+		panic(fmt.Sprintf("converter must have the shape func(string) (T, error), got %s", t))
+	}
+	r.converters[t.Out(0)] = reflect.ValueOf(converter)
+}
 
 // ParseForm parses req.Form and then serializes the form data to
 // the dst struct using reflection. The form names should match to
-// the 'html' tag or, if its not setted, to the field name.
-// ParseForm only supports serializing data to one-depth structs.
+// the 'html' tag or, if its not setted, to the field name. Fields
+// with the tag html:"-" are ignored, like fields read by Bind from other
+// sources (tagged path, query, header or cookie).
 // Example, using
 // this struct as target:
 //
@@ -36,6 +104,24 @@ const multipartFormMaxSize = 64 << 20 // 20MB
 //
 // { A = false, B: 2 }
 //
+// Nested structures are supported using dotted and indexed names:
+//
+//   - Structs: "Address.Street". Embedded structs do not add a prefix.
+//
+//   - Slices and arrays: "Items[0].Name", or repeated names for slices
+//     of basic types, like checkbox groups: "Tags=a&Tags=b". Indexes
+//     must be contiguous from 0: the ones after a gap are ignored.
+//
+//   - Maps: "Meta[key]" or "Meta[key].Name".
+//
+// The depth and the number of elements are limited by FormOptions.
+//
+// ParseForm returns a validation error (named validator.InvalidTypeName)
+// for each form value that cannot be converted to the type of its field,
+// using the form name as key. Those errors can be rendered with
+// RenderWithErrors, like the ones returned by Validate. Empty values
+// are not errors: the field is left untouched.
+//
 // The supported field types are:
 //
 //   - int, int8, int16, int32, int64
@@ -48,42 +134,476 @@ const multipartFormMaxSize = 64 << 20 // 20MB
 //
 //   - string
 //
-//   - time.Time
-func (ctx *Context) ParseForm(dst interface{}) {
+//   - time.Time. The format tag selects the layout: "date", "time",
+//     "datetime" (the default, 2006-01-02T15:04), "rfc3339" or any custom
+//     layout, like format:"02/01/2006".
+//
+//   - types implementing encoding.TextUnmarshaler and types with a
+//     converter registered with Router.AddConverter.
+//
+//   - structs, slices, arrays and maps of the supported types,
+//     and pointers to them.
+//
+//   - *multipart.FileHeader, Upload and *Upload for uploaded files, and
+//     slices of them for multiple files with the same name. The tags
+//     maxsize (like maxsize:"2MB") and accept (a comma separated list
+//     of MIME types, like accept:"image/png,image/*") limit the size and
+//     the detected content type of each file. Files of fields with an
+//     invalid maxsize tag are always rejected, without other errors:
+//     the tags are reported by Router.Validate for the RouteDoc.Request
+//     types and by Typed when the handler is built.
+func (ctx *Context) ParseForm(dst interface{}) ValidationErrors {
 	contentType := ctx.Req.Header.Get("Content-Type")
-	if strings.HasPrefix(contentType, "multiplart/form-data") && ctx.Req.Form == nil {
+	if strings.HasPrefix(contentType, "multipart/form-data") && ctx.Req.Form == nil {
 		ctx.Req.ParseMultipartForm(multipartFormMaxSize)
 	} else if ctx.Req.Form == nil {
 		ctx.Req.ParseForm()
 	}
 
 	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
 	// Is a pointer to an interface. An interface is a pointer to something else.
 	e := v.Elem()
-	t := e.Type()
-	if t.Kind() != reflect.Struct {
+	if e.Kind() != reflect.Struct {
+		return nil
+	}
+	binder := newFormBinder(ctx, ctx.Req.Form)
+	if ctx.Req.MultipartForm != nil {
+		binder.files = ctx.Req.MultipartForm.File
+	}
+	binder.bindStruct(e, "", 0)
+	return binder.result()
+}
+
+// formBinder fills structs from url.Values. By default it uses the html
+// tag or the field name. When it is explicit (for sources like query or
+// headers) only fields with the tag are filled.
+type formBinder struct {
+	form       url.Values
+	converters map[reflect.Type]reflect.Value
+	files      map[string][]*multipart.FileHeader
+	opts       FormOptions
+	errs       ValidationErrors
+	tag        string
+	explicit   bool
+	normalize  func(string) string
+
+	// budget is the number of elements of slices, arrays and maps that
+	// can still be filled. It is shared by all collections of the bind.
+	budget int
+
+	// prefixes and subkeys index the form keys, so collections do not
+	// scan the whole form. They are built the first time they are needed.
+	prefixes map[string]bool
+	subkeys  map[string][]string
+}
+
+func newFormBinder(ctx *Context, form url.Values) *formBinder {
+	return &formBinder{
+		form:       form,
+		converters: ctx.converters,
+		opts:       ctx.formOptions,
+		errs:       ValidationErrors{},
+		tag:        "html",
+		budget:     ctx.formOptions.MaxElements,
+	}
+}
+
+// take consumes one element of the budget. It returns false if the
+// budget is exhausted.
+func (b *formBinder) take() bool {
+	if b.budget <= 0 {
+		return false
+	}
+	b.budget--
+	return true
+}
+
+func (b *formBinder) addError(name string, err core.ValidationError) {
+	b.errs[name] = append(b.errs[name], err)
+}
+
+func (b *formBinder) result() ValidationErrors {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return b.errs
+}
+
+func (b *formBinder) set(field reflect.Value, name, value string, tag reflect.StructTag) bool {
+	if b.convert(field, value, tag) {
+		return true
+	}
+	b.addError(name, validator.NewInvalidTypeError(name, typeDescription(field.Type(), tag)))
+	return false
+}
+
+// convert sets the value to the field using, in order, a converter
+// registered with Router.AddConverter, the format tag for time.Time,
+// encoding.TextUnmarshaler or setValue for basic types.
+func (b *formBinder) convert(field reflect.Value, value string, tag reflect.StructTag) bool {
+	t := field.Type()
+	isPointer := t.Kind() == reflect.Ptr
+	if isPointer {
+		t = t.Elem()
+	}
+	if len(value) == 0 && t.Kind() != reflect.String {
+		return true
+	}
+	converter, hasConverter := b.converters[t]
+	switch {
+	case hasConverter:
+		out := converter.Call([]reflect.Value{reflect.ValueOf(value)})
+		if !out[1].IsNil() {
+			return false
+		}
+		setConverted(field, out[0], isPointer)
+		return true
+	case t == reflect.TypeOf(time.Time{}):
+		parsed, err := time.Parse(timeLayout(tag), value)
+		if err != nil {
+			return false
+		}
+		setConverted(field, reflect.ValueOf(parsed), isPointer)
+		return true
+	case reflect.PointerTo(t).Implements(textUnmarshalerType()):
+		converted := reflect.New(t)
+		unmarshaler, _ := converted.Interface().(encoding.TextUnmarshaler)
+		if err := unmarshaler.UnmarshalText([]byte(value)); err != nil {
+			return false
+		}
+		setConverted(field, converted.Elem(), isPointer)
+		return true
+	default:
+		return setValue(field, value)
+	}
+}
+
+func setConverted(field, converted reflect.Value, isPointer bool) {
+	if !isPointer {
+		field.Set(converted)
 		return
 	}
-	num := t.NumField()
-	for i := range num {
+	ptr := reflect.New(converted.Type())
+	ptr.Elem().Set(converted)
+	field.Set(ptr)
+}
+
+const defaultTimeLayout string = "2006-01-02T15:04"
+
+// timeLayout returns the layout used to parse time.Time fields using the
+// format tag. It accepts "date", "time", "datetime" (the default),
+// "rfc3339" or any custom layout, like format:"02/01/2006".
+func timeLayout(tag reflect.StructTag) string {
+	format := tag.Get("format")
+	switch strings.ToLower(format) {
+	case "", "datetime":
+		return defaultTimeLayout
+	case "date":
+		return time.DateOnly
+	case "time":
+		return "15:04"
+	case "rfc3339":
+		return time.RFC3339
+	default:
+		return format
+	}
+}
+
+func typeDescription(t reflect.Type, tag reflect.StructTag) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return fmt.Sprintf("date (%s)", timeLayout(tag))
+		}
+		return t.String()
+	default:
+		return t.String()
+	}
+}
+
+func (b *formBinder) bindStruct(e reflect.Value, prefix string, depth int) {
+	t := e.Type()
+	for i := range t.NumField() {
 		fieldValue := e.Field(i)
 		fieldType := t.Field(i)
-		var lookup string
-		lookup, ok := fieldType.Tag.Lookup("html")
+		if !fieldValue.CanSet() {
+			continue
+		}
+		lookup, ok := fieldType.Tag.Lookup(b.tag)
+		if lookup == "-" || (!b.explicit && isSourceField(fieldType)) {
+			continue
+		}
+		if fieldType.Anonymous && !ok && b.isStruct(fieldType.Type) {
+			b.bindNested(fieldValue, prefix, depth)
+			continue
+		}
+		if !ok && b.explicit {
+			if fieldType.Type.Kind() == reflect.Struct && b.isStruct(fieldType.Type) && depth < b.opts.MaxDepth {
+				b.bindStruct(fieldValue, prefix, depth+1)
+			}
+			continue
+		}
 		if !ok {
 			lookup = fieldType.Name
 		}
-		if !ctx.Req.Form.Has(lookup) {
-			continue
+		if b.normalize != nil {
+			lookup = b.normalize(lookup)
+		}
+		b.bindField(fieldValue, prefix+lookup, fieldType.Tag, depth)
+	}
+}
+
+func (b *formBinder) bindField(field reflect.Value, name string, tag reflect.StructTag, depth int) {
+	if isFile(field.Type()) {
+		b.bindFiles(field, name, tag)
+		return
+	}
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if b.isScalar(t) {
+		if b.form.Has(name) {
+			b.set(field, name, b.form.Get(name), tag)
+		}
+		return
+	}
+	if depth >= b.opts.MaxDepth {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		b.bindNested(field, name+".", depth)
+	case reflect.Slice:
+		b.bindSlice(field, name, tag, depth)
+	case reflect.Array:
+		b.bindArray(field, name, tag, depth)
+	case reflect.Map:
+		b.bindMap(field, name, tag, depth)
+	default:
+	}
+}
+
+// bindNested fills a struct (or a pointer to a struct) whose fields
+// start with prefix. Nil pointers are only allocated if the form have
+// some value for them.
+func (b *formBinder) bindNested(field reflect.Value, prefix string, depth int) {
+	if field.Kind() == reflect.Ptr {
+		if !b.hasPrefix(prefix) {
+			return
+		}
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	b.bindStruct(field, prefix, depth+1)
+}
+
+func (b *formBinder) bindSlice(field reflect.Value, name string, tag reflect.StructTag, depth int) {
+	sliceType := field.Type()
+	if sliceType.Kind() == reflect.Ptr {
+		sliceType = sliceType.Elem()
+	}
+	slice := reflect.MakeSlice(sliceType, 0, 0)
+	if b.isScalar(sliceType.Elem()) {
+		for _, value := range b.form[name] {
+			if !b.take() {
+				break
+			}
+			elem := reflect.New(sliceType.Elem()).Elem()
+			if b.set(elem, name, value, tag) {
+				slice = reflect.Append(slice, elem)
+			}
+		}
+	}
+	// Indexes are sorted, so the slice only grows by one element at a
+	// time and sparse indexes cannot allocate big slices.
+	for _, i := range b.indexes(name) {
+		if i > slice.Len() {
+			break
 		}
-		if !fieldValue.IsValid() {
+		if i == slice.Len() {
+			if !b.take() {
+				break
+			}
+			slice = reflect.Append(slice, reflect.New(sliceType.Elem()).Elem())
+		}
+		b.bindField(slice.Index(i), fmt.Sprintf("%s[%d]", name, i), tag, depth+1)
+	}
+	if slice.Len() == 0 {
+		return
+	}
+	setCollection(field, slice)
+}
+
+func (b *formBinder) bindArray(field reflect.Value, name string, tag reflect.StructTag, depth int) {
+	array := field
+	if array.Kind() == reflect.Ptr {
+		if !b.hasPrefix(name + "[") {
+			return
+		}
+		if array.IsNil() {
+			array.Set(reflect.New(array.Type().Elem()))
+		}
+		array = array.Elem()
+	}
+	for _, i := range b.indexes(name) {
+		if i >= array.Len() || !b.take() {
+			break
+		}
+		b.bindField(array.Index(i), fmt.Sprintf("%s[%d]", name, i), tag, depth+1)
+	}
+}
+
+func (b *formBinder) bindMap(field reflect.Value, name string, tag reflect.StructTag, depth int) {
+	mapType := field.Type()
+	if mapType.Kind() == reflect.Ptr {
+		mapType = mapType.Elem()
+	}
+	keys := b.index().subkeys[name]
+	if len(keys) == 0 {
+		return
+	}
+	result := reflect.MakeMapWithSize(mapType, min(len(keys), b.budget))
+	for _, key := range keys {
+		if !b.take() {
+			break
+		}
+		keyValue := reflect.New(mapType.Key()).Elem()
+		if !b.isScalar(mapType.Key()) || !b.set(keyValue, fmt.Sprintf("%s[%s]", name, key), key, "") {
 			continue
 		}
-		if !fieldValue.CanSet() {
+		elem := reflect.New(mapType.Elem()).Elem()
+		b.bindField(elem, fmt.Sprintf("%s[%s]", name, key), tag, depth+1)
+		result.SetMapIndex(keyValue, elem)
+	}
+	setCollection(field, result)
+}
+
+func setCollection(field, collection reflect.Value) {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(collection.Type())
+		ptr.Elem().Set(collection)
+		field.Set(ptr)
+		return
+	}
+	field.Set(collection)
+}
+
+func (b *formBinder) hasPrefix(prefix string) bool {
+	return b.index().prefixes[prefix]
+}
+
+// index groups the form keys once. For a key like 'Items[0].Tags[a]' it
+// records the prefixes 'Items[', 'Items[0].', 'Items[0].Tags[' and the
+// sorted distinct subkeys found between brackets after each name:
+// '0' for 'Items' and 'a' for 'Items[0].Tags'. Each nesting level uses
+// at most two separators, so keys deeper than MaxDepth are not indexed.
+func (b *formBinder) index() *formBinder {
+	if b.prefixes != nil {
+		return b
+	}
+	b.prefixes = map[string]bool{}
+	found := map[string]map[string]bool{}
+	maxSeparators := 2 * (b.opts.MaxDepth + 1)
+	for key := range b.form {
+		separators := 0
+		for i := 0; i < len(key) && separators < maxSeparators; i++ {
+			switch key[i] {
+			case '.':
+				separators++
+				b.prefixes[key[:i+1]] = true
+			case '[':
+				separators++
+				b.prefixes[key[:i+1]] = true
+				end := strings.IndexByte(key[i+1:], ']')
+				if end < 0 {
+					continue
+				}
+				name := key[:i]
+				if found[name] == nil {
+					found[name] = map[string]bool{}
+				}
+				found[name][key[i+1:i+1+end]] = true
+			}
+		}
+	}
+	b.subkeys = make(map[string][]string, len(found))
+	for name, set := range found {
+		keys := make([]string, 0, len(set))
+		for key := range set {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.subkeys[name] = keys
+	}
+	return b
+}
+
+// indexes returns the sorted valid indexes used in form keys like
+// 'name[0]'. Indexes bigger than MaxElements are ignored.
+func (b *formBinder) indexes(name string) []int {
+	var indexes []int
+	for _, key := range b.index().subkeys[name] {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= b.opts.MaxElements {
 			continue
 		}
-		value := ctx.Req.FormValue(lookup)
-		setValue(fieldValue, value)
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (b *formBinder) isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !b.isScalar(t)
+}
+
+// isScalar reports if a single form value can be converted to the type,
+// using a registered converter, encoding.TextUnmarshaler or setValue.
+func (b *formBinder) isScalar(t reflect.Type) bool {
+	if _, ok := b.converters[t]; ok {
+		return true
+	}
+	if t.Kind() != reflect.Interface && reflect.PointerTo(t).Implements(textUnmarshalerType()) {
+		return true
+	}
+	return isScalar(t)
+}
+
+func textUnmarshalerType() reflect.Type {
+	return reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+}
+
+// isScalar reports if setValue can convert a single form value to the type.
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Struct:
+		return t == reflect.TypeOf(time.Time{})
+	default:
+		return false
 	}
 }
 
@@ -94,6 +614,9 @@ func setValue(field reflect.Value, value string) bool {
 		t = t.Elem()
 		isPointer = true
 	}
+	if len(value) == 0 && t.Kind() != reflect.String {
+		return true
+	}
 	switch t.Kind() {
 	case reflect.String:
 		return setString(field, value, isPointer)
@@ -140,19 +663,25 @@ func setValue(field reflect.Value, value string) bool {
 	}
 }
 
+// setBasic sets a basic value to the field, converting it to the field
+// type so named types (like core.Role) are also supported.
+func setBasic(field, value reflect.Value, isPointer bool) {
+	t := field.Type()
+	if isPointer {
+		t = t.Elem()
+	}
+	setConverted(field, value.Convert(t), isPointer)
+}
+
 func setDateTime(field reflect.Value, value string, isPointer bool) bool {
 	if len(value) == 0 {
 		return false
 	}
-	time, err := time.Parse("2006-01-02T15:04", value)
+	time, err := time.Parse(defaultTimeLayout, value)
 	if err != nil {
 		return false
 	}
-	if isPointer {
-		field.Set(reflect.ValueOf(&time))
-	} else {
-		field.Set(reflect.ValueOf(time))
-	}
+	setBasic(field, reflect.ValueOf(time), isPointer)
 	return true
 }
 
@@ -167,14 +696,7 @@ func setInt[T int | int8 | int16 | int32 | int64](
 		return false
 	}
 	p := T(i)
-	if isPointer {
-		if value == "" {
-			return true
-		}
-		field.Set(reflect.ValueOf(&p))
-	} else {
-		field.Set(reflect.ValueOf(p))
-	}
+	setBasic(field, reflect.ValueOf(p), isPointer)
 	return true
 }
 
@@ -189,14 +711,7 @@ func setUint[T uint | uint8 | uint16 | uint32 | uint64](
 		return false
 	}
 	p := T(i)
-	if isPointer {
-		if value == "" {
-			return true
-		}
-		field.Set(reflect.ValueOf(&p))
-	} else {
-		field.Set(reflect.ValueOf(p))
-	}
+	setBasic(field, reflect.ValueOf(p), isPointer)
 	return true
 }
 
@@ -211,14 +726,7 @@ func setFloat[T float64 | float32](
 		return false
 	}
 	p := T(f)
-	if isPointer {
-		if value == "" {
-			return true
-		}
-		field.Set(reflect.ValueOf(&p))
-	} else {
-		field.Set(reflect.ValueOf(p))
-	}
+	setBasic(field, reflect.ValueOf(p), isPointer)
 	return true
 }
 
@@ -227,25 +735,14 @@ func setBool(field reflect.Value, value string, isPointer bool) bool {
 	if err != nil {
 		return false
 	}
-	if isPointer {
-		if value == "" {
-			return true
-		}
-		field.Set(reflect.ValueOf(&b))
-	} else {
-		field.Set(reflect.ValueOf(b))
-	}
+	setBasic(field, reflect.ValueOf(b), isPointer)
 	return true
 }
 
 func setString(field reflect.Value, value string, isPointer bool) bool {
-	if isPointer {
-		if value == "" {
-			return true
-		}
-		field.Set(reflect.ValueOf(&value))
-	} else {
-		field.Set(reflect.ValueOf(value))
+	if isPointer && value == "" {
+		return true
 	}
+	setBasic(field, reflect.ValueOf(value), isPointer)
 	return true
 }
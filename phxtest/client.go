@@ -0,0 +1,383 @@
+// Package phxtest provides an in-process client to test phx applications.
+//
+//	func TestLogin(t *testing.T) {
+//		c := phxtest.New(t, app.NewRouter())
+//		c.Get("/login").AssertStatus(http.StatusOK).AssertTemplate(views.Login)
+//		c.PostForm("/login", url.Values{"Name": {"admin"}}).AssertRedirect("/demo")
+//		c.Get("/demo").AssertStatus(http.StatusOK)
+//	}
+package phxtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deltegui/phx"
+	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/csrf"
+	"github.com/deltegui/phx/cypher"
+	"github.com/deltegui/phx/session"
+)
+
+// Client drives a phx.Router in memory. It keeps the cookies sent by
+// the application between requests and sends the last CSRF token found
+// in a response with every unsafe request.
+type Client struct {
+	t       testing.TB
+	router  *phx.Router
+	cookies map[string]*http.Cookie
+	token   string
+
+	// Header is sent with every request.
+	Header http.Header
+
+	mutex    sync.Mutex
+	rendered []string
+}
+
+// New creates a Client for the router. The router is validated like
+// Listen does, and the test fails if it is misconfigured. If the router
+// have a phx.Renderer registered, it is wrapped to record the templates
+// rendered for the requests of the clients, so Response.AssertTemplate
+// can be used. All clients of a router share the wrapper, and the original
+// renderer is registered again when the tests of all of them end.
+func New(t testing.TB, r *phx.Router) *Client {
+	t.Helper()
+	if err := r.Validate(); err != nil {
+		t.Fatalf("invalid router: %s", err)
+	}
+	c := &Client{
+		t:       t,
+		router:  r,
+		cookies: map[string]*http.Cookie{},
+		Header:  http.Header{},
+	}
+	if installRecorder(r) {
+		t.Cleanup(func() { uninstallRecorder(r) })
+	}
+	return c
+}
+
+type recorderInstall struct {
+	inner   phx.Renderer
+	clients int
+}
+
+var (
+	recorders      = map[*phx.Router]*recorderInstall{}
+	recordersMutex sync.Mutex
+)
+
+// installRecorder wraps the phx.Renderer of the router with a
+// recordingRenderer, unless it is already wrapped. It returns false if the
+// router does not have a renderer.
+func installRecorder(r *phx.Router) bool {
+	recordersMutex.Lock()
+	defer recordersMutex.Unlock()
+	if install, ok := recorders[r]; ok {
+		install.clients++
+		return true
+	}
+	var rend phx.Renderer
+	instance, err := r.GetByType(reflect.TypeOf(&rend).Elem())
+	if err != nil {
+		return false
+	}
+	rend, ok := instance.(phx.Renderer)
+	if !ok {
+		return false
+	}
+	if recorder, ok := rend.(recordingRenderer); ok {
+		rend = recorder.inner
+	}
+	recorders[r] = &recorderInstall{inner: rend, clients: 1}
+	recorder := recordingRenderer{inner: rend}
+	r.AddSingleton(func() phx.Renderer { return recorder })
+	return true
+}
+
+// uninstallRecorder registers the original renderer again when the last
+// client of the router is done.
+func uninstallRecorder(r *phx.Router) {
+	recordersMutex.Lock()
+	defer recordersMutex.Unlock()
+	install := recorders[r]
+	if install.clients--; install.clients > 0 {
+		return
+	}
+	delete(recorders, r)
+	inner := install.inner
+	r.AddSingleton(func() phx.Renderer { return inner })
+}
+
+// clientKey is the key of the request context value that tells the
+// recordingRenderer which Client sent the request.
+type clientKey struct{}
+
+func (c *Client) cypher() core.Cypher {
+	var cy core.Cypher
+	instance, err := c.router.GetByType(reflect.TypeOf(&cy).Elem())
+	if err != nil {
+		return nil
+	}
+	cy, _ = instance.(core.Cypher)
+	return cy
+}
+
+// Do sends the request to the router, adding the stored cookies, the
+// default headers and the CSRF token.
+func (c *Client) Do(req *http.Request) *Response {
+	c.t.Helper()
+	for key, values := range c.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	if isUnsafe(req.Method) && len(req.Header.Get(csrf.CsrfHeaderName)) == 0 {
+		if token := c.CsrfToken(); len(token) > 0 {
+			req.Header.Set(csrf.CsrfHeaderName, token)
+		}
+	}
+
+	c.mutex.Lock()
+	c.rendered = nil
+	c.mutex.Unlock()
+
+	req = req.WithContext(context.WithValue(req.Context(), clientKey{}, c))
+	recorder := httptest.NewRecorder()
+	c.router.ServeHTTP(recorder, req)
+	result := recorder.Result()
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		c.t.Fatalf("cannot read response body: %s", err)
+	}
+	c.storeCookies(result.Cookies())
+	if token := extractCsrfToken(body); len(token) > 0 {
+		c.token = token
+	}
+
+	c.mutex.Lock()
+	rendered := c.rendered
+	c.mutex.Unlock()
+
+	return &Response{
+		t:         c.t,
+		Response:  result,
+		Body:      body,
+		Templates: rendered,
+	}
+}
+
+// Request builds and sends a request.
+func (c *Client) Request(method, path, contentType string, body io.Reader) *Response {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Get(path string) *Response {
+	c.t.Helper()
+	return c.Request(http.MethodGet, path, "", nil)
+}
+
+func (c *Client) Delete(path string) *Response {
+	c.t.Helper()
+	return c.Request(http.MethodDelete, path, "", nil)
+}
+
+func (c *Client) Post(path, contentType string, body io.Reader) *Response {
+	c.t.Helper()
+	return c.Request(http.MethodPost, path, contentType, body)
+}
+
+func (c *Client) PostForm(path string, form url.Values) *Response {
+	c.t.Helper()
+	return c.Post(path, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+}
+
+// Json sends data encoded as JSON using the provided method.
+func (c *Client) Json(method, path string, data any) *Response {
+	c.t.Helper()
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		c.t.Fatalf("cannot encode request body as JSON: %s", err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return c.Do(req)
+}
+
+func (c *Client) PostJson(path string, data any) *Response {
+	c.t.Helper()
+	return c.Json(http.MethodPost, path, data)
+}
+
+func isUnsafe(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead &&
+		method != http.MethodOptions && method != http.MethodTrace
+}
+
+func (c *Client) storeCookies(cookies []*http.Cookie) {
+	now := time.Now()
+	for _, cookie := range cookies {
+		expired := cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(now))
+		if expired || len(cookie.Value) == 0 {
+			delete(c.cookies, cookie.Name)
+			continue
+		}
+		c.cookies[cookie.Name] = &http.Cookie{
+			Name:  cookie.Name,
+			Value: cookie.Value,
+		}
+	}
+}
+
+// Cookie returns the value of a stored cookie. Values encrypted using
+// cypher.EncodeCookie are decoded with the router's core.Cypher.
+func (c *Client) Cookie(name string) (string, bool) {
+	cookie, ok := c.cookies[name]
+	if !ok {
+		return "", false
+	}
+	if cy := c.cypher(); cy != nil {
+		if decoded, err := cypher.DecodeCookie(cy, cookie.Value); err == nil {
+			return decoded, true
+		}
+	}
+	return cookie.Value, true
+}
+
+// SetCookie stores a cookie to be sent in the next requests. The value
+// is encrypted with the router's core.Cypher, like phx.Context does.
+func (c *Client) SetCookie(name, value string) {
+	if cy := c.cypher(); cy != nil {
+		encoded, err := cypher.EncodeCookie(cy, value)
+		if err != nil {
+			c.t.Fatalf("cannot encode cookie '%s': %s", name, err)
+		}
+		value = encoded
+	}
+	c.cookies[name] = &http.Cookie{Name: name, Value: value}
+}
+
+func (c *Client) DeleteCookie(name string) {
+	delete(c.cookies, name)
+}
+
+// LoginAs creates a session for the user using the router's
+// *session.Manager and stores the session cookie.
+func (c *Client) LoginAs(user session.User) {
+	c.t.Helper()
+	instance, err := c.router.GetByType(reflect.TypeOf(&session.Manager{}))
+	if err != nil {
+		c.t.Fatalf("cannot login: %s", err)
+	}
+	manager, ok := instance.(*session.Manager)
+	if !ok {
+		c.t.Fatalf("cannot login: registered session manager is %T", instance)
+	}
+	recorder := httptest.NewRecorder()
+	manager.CreateSessionCookie(recorder, user)
+	result := recorder.Result()
+	defer result.Body.Close()
+	c.storeCookies(result.Cookies())
+}
+
+// CsrfToken returns the last CSRF token found in a response. If no token
+// have been found, a new one is generated with the router's *csrf.Csrf.
+func (c *Client) CsrfToken() string {
+	if len(c.token) > 0 {
+		return c.token
+	}
+	instance, err := c.router.GetByType(reflect.TypeOf(&csrf.Csrf{}))
+	if err != nil {
+		return ""
+	}
+	cs, ok := instance.(*csrf.Csrf)
+	if !ok {
+		return ""
+	}
+	return cs.Generate()
+}
+
+var (
+	csrfTagRegexp   = regexp.MustCompile(`<(?:input|meta)[^>]*` + regexp.QuoteMeta(csrf.CsrfHeaderName) + `[^>]*>`)
+	csrfValueRegexp = regexp.MustCompile(`(?:value|content)\s*=\s*"([^"]*)"`)
+)
+
+func extractCsrfToken(body []byte) string {
+	tags := csrfTagRegexp.FindAll(body, -1)
+	for i := len(tags) - 1; i >= 0; i-- {
+		if match := csrfValueRegexp.FindSubmatch(tags[i]); match != nil && len(match[1]) > 0 {
+			return html.UnescapeString(string(match[1]))
+		}
+	}
+	return ""
+}
+
+type recordingRenderer struct {
+	inner phx.Renderer
+}
+
+// record adds the template to the Client that sent the request, if any.
+func (r recordingRenderer) record(ctx *phx.Context, parsed string) {
+	client, ok := ctx.Req.Context().Value(clientKey{}).(*Client)
+	if !ok {
+		return
+	}
+	client.mutex.Lock()
+	client.rendered = append(client.rendered, parsed)
+	client.mutex.Unlock()
+}
+
+func (r recordingRenderer) Render(ctx *phx.Context, status int, parsed string, vm interface{}) error {
+	r.record(ctx, parsed)
+	return r.inner.Render(ctx, status, parsed, vm)
+}
+
+func (r recordingRenderer) RenderBlock(ctx *phx.Context, status int, parsed, blockName string, vm interface{}) error {
+	r.record(ctx, parsed)
+	return r.inner.RenderBlock(ctx, status, parsed, blockName, vm)
+}
+
+func (r recordingRenderer) RenderWithErrors(
+	ctx *phx.Context,
+	status int,
+	parsed string,
+	vm interface{},
+	formErrors map[string][]core.ValidationError,
+) error {
+	r.record(ctx, parsed)
+	return r.inner.RenderWithErrors(ctx, status, parsed, vm, formErrors)
+}
+
+func (r recordingRenderer) RenderBlockWithErrors(
+	ctx *phx.Context,
+	status int,
+	parsed, blockName string,
+	vm interface{},
+	formErrors map[string][]core.ValidationError,
+) error {
+	r.record(ctx, parsed)
+	return r.inner.RenderBlockWithErrors(ctx, status, parsed, blockName, vm, formErrors)
+}
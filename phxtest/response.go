@@ -0,0 +1,100 @@
+package phxtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Response is the result of a request made with Client. Assertions
+// report failures using the testing.TB of the Client and return the
+// response, so they can be chained.
+type Response struct {
+	*http.Response
+	t testing.TB
+
+	Body []byte
+
+	// Templates contains the parsed names rendered during the request.
+	Templates []string
+}
+
+func (res *Response) String() string {
+	return string(res.Body)
+}
+
+func (res *Response) AssertStatus(status int) *Response {
+	res.t.Helper()
+	if res.StatusCode != status {
+		res.t.Errorf("expected status %d, got %d. Body: %s", status, res.StatusCode, res.Body)
+	}
+	return res
+}
+
+func (res *Response) AssertHeader(key, value string) *Response {
+	res.t.Helper()
+	if got := res.Header.Get(key); got != value {
+		res.t.Errorf("expected header '%s' to be '%s', got '%s'", key, value, got)
+	}
+	return res
+}
+
+func (res *Response) AssertRedirect(location string) *Response {
+	res.t.Helper()
+	if res.StatusCode < http.StatusMultipleChoices || res.StatusCode >= http.StatusBadRequest {
+		res.t.Errorf("expected a redirect, got status %d", res.StatusCode)
+	}
+	return res.AssertHeader("Location", location)
+}
+
+func (res *Response) AssertBodyContains(text string) *Response {
+	res.t.Helper()
+	if !strings.Contains(string(res.Body), text) {
+		res.t.Errorf("expected body to contain '%s'. Body: %s", text, res.Body)
+	}
+	return res
+}
+
+// AssertJson checks that the body is JSON equivalent to expected, which
+// can be any value that encodes to JSON.
+func (res *Response) AssertJson(expected any) *Response {
+	res.t.Helper()
+	encoded, err := json.Marshal(expected)
+	if err != nil {
+		res.t.Fatalf("cannot encode expected value as JSON: %s", err)
+	}
+	var want, got any
+	if err := json.Unmarshal(encoded, &want); err != nil {
+		res.t.Fatalf("cannot decode expected value: %s", err)
+	}
+	if err := json.Unmarshal(res.Body, &got); err != nil {
+		res.t.Errorf("expected a JSON body: %s. Body: %s", err, res.Body)
+		return res
+	}
+	if !reflect.DeepEqual(want, got) {
+		res.t.Errorf("expected JSON body %s, got %s", encoded, res.Body)
+	}
+	return res
+}
+
+// DecodeJson decodes the body into dst.
+func (res *Response) DecodeJson(dst any) *Response {
+	res.t.Helper()
+	if err := json.Unmarshal(res.Body, dst); err != nil {
+		res.t.Fatalf("cannot decode JSON body: %s. Body: %s", err, res.Body)
+	}
+	return res
+}
+
+// AssertTemplate checks that the template with the parsed name have been
+// rendered during the request.
+func (res *Response) AssertTemplate(parsed string) *Response {
+	res.t.Helper()
+	if !slices.Contains(res.Templates, parsed) {
+		res.t.Errorf("expected template '%s' to be rendered, rendered: %v", parsed, res.Templates)
+	}
+	return res
+}
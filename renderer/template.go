@@ -1,15 +1,16 @@
 package renderer
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"html/template"
-	"log"
 	"strings"
 
 	"github.com/deltegui/phx"
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/localizer"
+	"github.com/deltegui/phx/logging"
 	"github.com/deltegui/phx/model"
 )
 
@@ -17,6 +18,17 @@ type TemplateRenderer struct {
 	tmpl      map[string]*template.Template
 	tmplFuncs template.FuncMap
 	tmplFS    embed.FS
+	urls      URLResolver
+}
+
+// URLResolver builds the URL of a named route, like phx.Router.URL.
+type URLResolver func(name string, params ...any) (string, error)
+
+// SetURLResolver sets the resolver used by the "url" template function:
+//
+//	<a href="{{ url "users.show" "id" .Model.Id }}">Profile</a>
+func (r *TemplateRenderer) SetURLResolver(resolver URLResolver) {
+	r.urls = resolver
 }
 
 func NewTemplateRenderer(fs embed.FS) *TemplateRenderer {
@@ -28,9 +40,8 @@ func NewTemplateRenderer(fs embed.FS) *TemplateRenderer {
 }
 
 func (r *TemplateRenderer) ShowAvailableTemplates() {
-	log.Println("Templates:")
 	for key, value := range r.tmpl {
-		log.Println(key, "->", value.Tree.Name)
+		logging.Logger().Info("template", "name", key, "main", value.Tree.Name)
 	}
 }
 
@@ -38,58 +49,58 @@ func (r *TemplateRenderer) RenderBlock(ctx *phx.Context, status int, parsed, blo
 	if ctx == nil {
 		panic("Called to Render outside request: no context!")
 	}
-	ctx.Res.WriteHeader(status)
 	model := model.CreateViewModel(ctx, parsed, vm)
-	template, ok := r.tmpl[parsed]
-	if !ok {
-		return fmt.Errorf("error executing template with parsed name: '%s'. It does not exists", parsed)
-	}
-	if err := template.ExecuteTemplate(ctx.Res, blockName, model); err != nil {
-		return fmt.Errorf("error executing tempalte with parsed name '%s': %w", parsed, err)
-	}
-	return nil
+	return r.execute(ctx, status, parsed, blockName, model)
 }
 
 func (r *TemplateRenderer) Render(ctx *phx.Context, status int, parsed string, vm interface{}) error {
 	if ctx == nil {
 		panic("Called to Render outside request: no context!")
 	}
-	ctx.Res.WriteHeader(status)
 	model := model.CreateViewModel(ctx, parsed, vm)
-	template, ok := r.tmpl[parsed]
-	if !ok {
-		return fmt.Errorf("error executing template with parsed name: '%s'. It does not exists", parsed)
-	}
-	if err := template.Execute(ctx.Res, model); err != nil {
-		return fmt.Errorf("error executing tempalte with parsed name '%s': %w", parsed, err)
-	}
-	return nil
+	return r.execute(ctx, status, parsed, "", model)
 }
 
 func (r *TemplateRenderer) RenderWithErrors(ctx *phx.Context, status int, parsed string, vm interface{}, formErrors map[string][]core.ValidationError) error {
 	if ctx == nil {
 		panic("Called to Render outside request: no context!")
 	}
-	ctx.Res.WriteHeader(status)
 	model := model.CreateViewModel(ctx, parsed, vm)
 	model.FormErrors = formErrors
-	if err := r.tmpl[parsed].Execute(ctx.Res, model); err != nil {
-		return fmt.Errorf("error executing tempalte with parsed name '%s': %w", parsed, err)
-	}
-	return nil
+	return r.execute(ctx, status, parsed, "", model)
 }
 
 func (r *TemplateRenderer) RenderBlockWithErrors(ctx *phx.Context, status int, parsed, blockName string, vm interface{}, formErrors map[string][]core.ValidationError) error {
 	if ctx == nil {
 		panic("Called to Render outside request: no context!")
 	}
-	ctx.Res.WriteHeader(status)
 	model := model.CreateViewModel(ctx, parsed, vm)
 	model.FormErrors = formErrors
-	if err := r.tmpl[parsed].ExecuteTemplate(ctx.Res, blockName, model); err != nil {
+	return r.execute(ctx, status, parsed, blockName, model)
+}
+
+// execute runs the template, or one of its blocks if blockName is not
+// empty, into a buffer. The status is sent after that, so templates can
+// still set headers (reading flash messages deletes their cookie) and
+// failed templates do not send half a page.
+func (r *TemplateRenderer) execute(ctx *phx.Context, status int, parsed, blockName string, vm model.ViewModel) error {
+	tmpl, ok := r.tmpl[parsed]
+	if !ok {
+		return fmt.Errorf("error executing template with parsed name: '%s'. It does not exists", parsed)
+	}
+	var buf bytes.Buffer
+	var err error
+	if len(blockName) > 0 {
+		err = tmpl.ExecuteTemplate(&buf, blockName, vm)
+	} else {
+		err = tmpl.Execute(&buf, vm)
+	}
+	if err != nil {
 		return fmt.Errorf("error executing tempalte with parsed name '%s': %w", parsed, err)
 	}
-	return nil
+	ctx.Res.WriteHeader(status)
+	_, err = buf.WriteTo(ctx.Res)
+	return err
 }
 
 func (r *TemplateRenderer) AddDefaultTemplateFunctions() {
@@ -121,6 +132,12 @@ func (r *TemplateRenderer) AddDefaultTemplateFunctions() {
 			return model.CreateSelectListViewModel(loc, name, items, true)
 		},
 		"YesNoSelectList": model.CreateYesNoSelectListViewModel,
+		"url": func(name string, params ...any) (string, error) {
+			if r.urls == nil {
+				return "", fmt.Errorf("cannot build URL for route '%s': no URL resolver have been set", name)
+			}
+			return r.urls(name, params...)
+		},
 	}
 }
 
@@ -150,7 +167,7 @@ func (r *TemplateRenderer) ParsePartial(name string, patterns ...string) {
 	}
 	compilation, err := tmpl.ParseFS(r.tmplFS, patterns...)
 	if err != nil {
-		log.Panicln("Failed to parse partial view:", err)
+		logging.Panic("cannot parse partial view", err)
 	}
 	main := fmt.Sprintf("{{ template \"%s\" . }}", name)
 	r.tmpl[name] = template.Must(compilation.Parse(main))
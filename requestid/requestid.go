@@ -0,0 +1,81 @@
+// Package requestid identifies requests so the log lines of a request
+// (and the requests it makes to other services) can be correlated. Use
+// middleware.RequestId to set the id of the incoming requests.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header is the header used to receive, send and propagate the id.
+const Header string = "X-Request-Id"
+
+// ContextKey is the key of the id in the request's context.
+const ContextKey string = "phx_request_id"
+
+const maxLength = 128
+
+// Generate creates a new random id.
+func Generate() string {
+	const size = 16
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic("cannot generate request id: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Valid reports if an id received from a client can be used. Only short
+// ids made of letters, digits and "-_.:" are accepted, so they are safe
+// to write in logs and headers.
+func Valid(id string) bool {
+	if len(id) == 0 || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		isAlphanumeric := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlphanumeric && c != '-' && c != '_' && c != '.' && c != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx that holds the id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ContextKey, id)
+}
+
+// FromContext returns the id stored in the context.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ContextKey).(string)
+	return id, ok && len(id) > 0
+}
+
+// Transport is an http.RoundTripper that sends the id of the request's
+// context in the Header of outgoing requests, so it is propagated to
+// other services. Use it with requests created with the phx.Context:
+//
+//	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+type Transport struct {
+	// Base is the RoundTripper used to make the requests. By default
+	// http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	id, ok := FromContext(req.Context())
+	if !ok || len(req.Header.Get(Header)) > 0 {
+		return base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+package phx
+
+import (
+	"net/http"
+)
+
+// responseWriter wraps the http.ResponseWriter given by net/http to know
+// if the response have been already written, which status was sent and
+// how many bytes of body.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+	size    int
+	hooks   []func()
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+// beforeWriteHeader registers a function that is called before the
+// headers are sent, so it can still set them.
+func (w *responseWriter) beforeWriteHeader(hook func()) {
+	w.hooks = append(w.hooks, hook)
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.written {
+		return
+	}
+	w.status = status
+	w.written = true
+	for _, hook := range w.hooks {
+		hook()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the original ResponseWriter.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
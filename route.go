@@ -0,0 +1,327 @@
+package phx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/deltegui/phx/logging"
+)
+
+// Route is a route registered in a Router. It is returned by Handle and
+// the method helpers (Get, Post...) so it can be annotated:
+//
+//	r.Post("/api/users", handlers.CreateUser).Doc(phx.RouteDoc{
+//		Summary:   "Creates a new user",
+//		Tags:      []string{"users"},
+//		Request:   CreateUserRequest{},
+//		Responses: map[int]any{http.StatusCreated: UserResponse{}},
+//	})
+type Route struct {
+	router      *Router
+	name        string
+	method      string
+	pattern     string
+	builder     Builder
+	middlewares []string
+	doc         RouteDoc
+	preferJson  bool
+
+	buildOnce sync.Once
+	handler   Handler
+	buildErr  error
+}
+
+// RouteDoc describes a route to generate API documentation. Request and
+// responses are sample values of the Go types used by the handler, and
+// their tags (json, path, query, header, cookie and valtruc) are used
+// to describe them.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+
+	// Hidden excludes the route from the generated documentation.
+	Hidden bool
+
+	// Request is a value of the type the handler binds, usually with Bind
+	// or Typed. Nil if the route does not read anything from the request.
+	Request any
+
+	// Responses maps status codes to values of the types sent to the
+	// client. Use a nil value for responses without body.
+	Responses map[int]any
+}
+
+// RouteInfo is the information collected about a registered route.
+type RouteInfo struct {
+	Name    string `json:"name,omitempty"`
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+
+	// Middlewares contains the names of the functions of the middlewares
+	// that wrap the route (global, group and route ones) from the outermost
+	// to the innermost. Middlewares are usually closures, so the names look
+	// like "github.com/deltegui/phx/middleware.Authorize.func1".
+	Middlewares []string `json:"middlewares"`
+
+	// Handler is the name of the handler builder and Source the file and
+	// line where it is defined.
+	Handler string `json:"handler"`
+	Source  string `json:"source"`
+
+	Doc RouteDoc `json:"-"`
+}
+
+// Doc sets the documentation of the route.
+func (rt *Route) Doc(doc RouteDoc) *Route {
+	rt.doc = doc
+	return rt
+}
+
+// PreferJson makes the ErrorHandler respond with JSON to every error of
+// the route, including the ones returned by its middlewares, no matter
+// what the client accepts. Use it for routes of Typed handlers:
+//
+//	r.Post("/api/users", handlers.CreateUser).PreferJson()
+func (rt *Route) PreferJson() *Route {
+	rt.preferJson = true
+	return rt
+}
+
+// Named sets the name used to build the URL of the route with Router.URL.
+// Names must be unique:
+//
+//	r.Get("/users/:id", handlers.ShowUser).Named("users.show")
+//	url, err := r.URL("users.show", "id", 42, "tab", "posts") // /users/42?tab=posts
+func (rt *Route) Named(name string) *Route {
+	if other, ok := rt.router.names[name]; ok && other != rt {
+		panic(fmt.Sprintf("route name '%s' is already used by route %s", name, other))
+	}
+	delete(rt.router.names, rt.name)
+	rt.name = name
+	rt.router.names[name] = rt
+	return rt
+}
+
+func (rt *Route) Name() string {
+	return rt.name
+}
+
+func (rt *Route) Method() string {
+	return rt.method
+}
+
+func (rt *Route) Pattern() string {
+	return rt.pattern
+}
+
+func (rt *Route) String() string {
+	if len(rt.pattern) == 0 {
+		return rt.name
+	}
+	return fmt.Sprintf("%s %s", rt.method, rt.pattern)
+}
+
+func (rt *Route) info() RouteInfo {
+	handler, source := funcLocation(rt.builder)
+	return RouteInfo{
+		Handler:     handler,
+		Source:      source,
+		Name:        rt.name,
+		Method:      rt.method,
+		Pattern:     rt.pattern,
+		Middlewares: slices.Clone(rt.middlewares),
+		Doc:         rt.doc,
+	}
+}
+
+// Routes returns the information about all routes registered in the
+// router (and its groups) in registration order. Use WriteRoutes or
+// WriteRoutesJson to export them.
+func (r *Router) Routes() []RouteInfo {
+	if r.parent != nil {
+		return r.parent.Routes()
+	}
+	infos := make([]RouteInfo, 0, len(r.routes))
+	for _, rt := range r.routes {
+		infos = append(infos, rt.info())
+	}
+	return infos
+}
+
+// sortedRoutes returns the routes sorted by pattern and method, so
+// listings of different versions of an application can be compared.
+func (r *Router) sortedRoutes() []RouteInfo {
+	routes := r.Routes()
+	slices.SortStableFunc(routes, func(a, b RouteInfo) int {
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+	return routes
+}
+
+// WriteRoutes writes a table with the registered routes sorted by pattern
+// and method.
+func (r *Router) WriteRoutes(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tNAME\tMIDDLEWARES\tHANDLER\tSOURCE")
+	for _, rt := range r.sortedRoutes() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			rt.Method,
+			rt.Pattern,
+			orDash(rt.Name),
+			orDash(strings.Join(rt.Middlewares, ", ")),
+			rt.Handler,
+			rt.Source)
+	}
+	return tw.Flush()
+}
+
+func orDash(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
+
+// WriteRoutesJson writes the registered routes sorted by pattern and
+// method as a JSON array.
+func (r *Router) WriteRoutesJson(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.sortedRoutes())
+}
+
+// ShowAvailableRoutes prints all registered routes.
+func (r *Router) ShowAvailableRoutes() {
+	for _, rt := range r.sortedRoutes() {
+		logging.Logger().Info("route",
+			"method", rt.Method,
+			"pattern", rt.Pattern,
+			"name", rt.Name,
+			"middlewares", rt.Middlewares,
+			"handler", rt.Handler,
+			"source", rt.Source)
+	}
+}
+
+// RoutesCommand implements a "routes" command for applications. If the
+// first argument is "routes" it writes the routes table (or JSON, with the
+// "--json" flag) to the standard output and returns true:
+//
+//	if r.RoutesCommand(os.Args[1:]) {
+//		return
+//	}
+//	r.Listen(":8080")
+func (r *Router) RoutesCommand(args []string) bool {
+	if len(args) == 0 || args[0] != "routes" {
+		return false
+	}
+	var err error
+	if slices.Contains(args[1:], "--json") {
+		err = r.WriteRoutesJson(os.Stdout)
+	} else {
+		err = r.WriteRoutes(os.Stdout)
+	}
+	if err != nil {
+		logging.Logger().Error("cannot list routes", "error", err)
+	}
+	return true
+}
+
+// URL builds the path of the route with the provided name. Params are
+// key-value pairs: keys that match a param of the route pattern fill it,
+// the other ones are encoded in the query string.
+func (r *Router) URL(name string, params ...any) (string, error) {
+	if r.parent != nil {
+		return r.parent.URL(name, params...)
+	}
+	rt, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("there is no route named '%s'", name)
+	}
+	return rt.url(params)
+}
+
+func (rt *Route) url(params []any) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("cannot build URL for route '%s': params must be key-value pairs", rt.name)
+	}
+	query := url.Values{}
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("cannot build URL for route '%s': param key %v must be a string", rt.name, params[i])
+		}
+		query.Add(key, fmt.Sprint(params[i+1]))
+	}
+
+	segments := strings.Split(rt.pattern, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			continue
+		}
+		key := segment[1:]
+		if !query.Has(key) {
+			return "", fmt.Errorf("cannot build URL for route '%s': missing param '%s'", rt.name, key)
+		}
+		value := query[key][0]
+		if query[key] = query[key][1:]; len(query[key]) == 0 {
+			query.Del(key)
+		}
+		if segment[0] == '*' {
+			segments[i] = escapePath(strings.TrimPrefix(value, "/"))
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	path := strings.Join(segments, "/")
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// middlewareNames returns the names of the middleware functions in the
+// order they wrap the handler, from the outermost to the innermost.
+func middlewareNames(middlewares []Middleware) []string {
+	names := make([]string, 0, len(middlewares))
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		names = append(names, funcName(middlewares[i]))
+	}
+	return names
+}
+
+func funcLocation(fn any) (string, string) {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return "unknown", "unknown"
+	}
+	file, line := f.FileLine(f.Entry())
+	return f.Name(), fmt.Sprintf("%s:%d", file, line)
+}
+
+func funcName(fn any) string {
+	name, _ := funcLocation(fn)
+	return name
+}
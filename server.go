@@ -0,0 +1,152 @@
+package phx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/deltegui/phx/logging"
+)
+
+const defaultShutdownTimeout = 5 * time.Second
+
+type ServerOptions struct {
+	// Address to listen. Ignored if a Listener is provided.
+	Addr string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// Set TLSConfig or CertFile and KeyFile to serve HTTPS.
+	TLSConfig *tls.Config
+	CertFile  string
+	KeyFile   string
+
+	// Time that active connections have to finish when the server
+	// is stopped. By default 5 seconds.
+	ShutdownTimeout time.Duration
+
+	// Listener to use instead of listening on Addr.
+	Listener net.Listener
+}
+
+// Server is an http.Server that knows how to stop itself gracefully.
+type Server struct {
+	*http.Server
+	router          *Router
+	listener        net.Listener
+	certFile        string
+	keyFile         string
+	shutdownTimeout time.Duration
+}
+
+// Server creates a Server that serves this router.
+func (r *Router) Server(opts ServerOptions) *Server {
+	shutdownTimeout := opts.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	server := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           r,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+		MaxHeaderBytes:    opts.MaxHeaderBytes,
+		TLSConfig:         opts.TLSConfig,
+	}
+	return &Server{
+		Server:          server,
+		router:          r,
+		listener:        opts.Listener,
+		certFile:        opts.CertFile,
+		keyFile:         opts.KeyFile,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+func (s *Server) isTLS() bool {
+	return s.TLSConfig != nil || (len(s.certFile) > 0 && len(s.keyFile) > 0)
+}
+
+// Start validates the router, calls the hooks registered with
+// Router.OnStart and serves requests until the server is stopped. It never
+// returns http.ErrServerClosed.
+func (s *Server) Start() error {
+	if err := s.router.Validate(); err != nil {
+		return fmt.Errorf("invalid dependency configuration: %w", err)
+	}
+	listener := s.listener
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", s.Addr)
+		if err != nil {
+			return fmt.Errorf("cannot listen on address '%s': %w", s.Addr, err)
+		}
+	}
+	s.router.runStartHooks()
+	logging.Logger().Info("listening", "address", listener.Addr().String())
+	logging.Logger().Info("You are ready to GO!")
+	var err error
+	if s.isTLS() {
+		err = s.ServeTLS(listener, s.certFile, s.keyFile)
+	} else {
+		err = s.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop shutdowns the server gracefully, waiting for active connections
+// during the configured ShutdownTimeout. Then it calls the hooks registered
+// with Router.OnShutdown and waits for them, even if the shutdown fails.
+// Use Stop instead of the Shutdown method of http.Server, that does not
+// call them.
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	defer s.router.runShutdownHooks()
+	if err := s.Shutdown(ctx); err != nil {
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+	return nil
+}
+
+// Run starts the server and stops it gracefully when the process receives
+// an interrupt or terminate signal.
+func (s *Server) Run() error {
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- s.Start()
+	}()
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(done)
+
+	select {
+	case err := <-startErr:
+		return err
+	case <-done:
+	}
+
+	logging.Logger().Info("server stopped")
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	logging.Logger().Info("server exited properly")
+	return <-startErr
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// ErrNoValue is returned when a Session does not have a value for a key.
+var ErrNoValue = errors.New("session does not have a value for the key")
+
+// Session gives access to the values stored in a session entry. Values
+// are encoded with the Manager's Serializer. The entry is only written to
+// the store by Save if some value has changed:
+//
+//	sess, err := ctx.Session()
+//	if err != nil {
+//		return err
+//	}
+//	cart, _ := session.GetValue[Cart](sess, "cart")
+//	cart.Add(product)
+//	if err := sess.Set("cart", cart); err != nil {
+//		return err
+//	}
+type Session struct {
+	manager *Manager
+	entry   Entry
+	dirty   bool
+	mutex   sync.Mutex
+}
+
+func newSession(manager *Manager, entry Entry) *Session {
+	// The store may keep the entry in memory, so the data is copied to
+	// not change it until Save is called.
+	entry.Data = maps.Clone(entry.Data)
+	if entry.Data == nil {
+		entry.Data = map[string][]byte{}
+	}
+	return &Session{
+		manager: manager,
+		entry:   entry,
+	}
+}
+
+func (sess *Session) Id() Id {
+	return sess.entry.Id
+}
+
+func (sess *Session) User() User {
+	return sess.entry.User
+}
+
+// Set stores the value for the key. The session is marked as changed only
+// if the encoded value is different from the stored one.
+func (sess *Session) Set(key string, value any) error {
+	data, err := sess.manager.serializer.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode session value '%s': %w", key, err)
+	}
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	if old, ok := sess.entry.Data[key]; ok && bytes.Equal(old, data) {
+		return nil
+	}
+	sess.entry.Data[key] = data
+	sess.dirty = true
+	return nil
+}
+
+// Get decodes the value of the key into dst. If there is no value,
+// ErrNoValue is returned.
+func (sess *Session) Get(key string, dst any) error {
+	sess.mutex.Lock()
+	data, ok := sess.entry.Data[key]
+	sess.mutex.Unlock()
+	if !ok {
+		return ErrNoValue
+	}
+	if err := sess.manager.serializer.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("cannot decode session value '%s': %w", key, err)
+	}
+	return nil
+}
+
+func (sess *Session) Has(key string) bool {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	_, ok := sess.entry.Data[key]
+	return ok
+}
+
+func (sess *Session) Delete(key string) {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	if _, ok := sess.entry.Data[key]; ok {
+		delete(sess.entry.Data, key)
+		sess.dirty = true
+	}
+}
+
+// Dirty reports if some value has changed since the session was loaded
+// or saved.
+func (sess *Session) Dirty() bool {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	return sess.dirty
+}
+
+// Save writes the entry to the store if some value has changed.
+func (sess *Session) Save() {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	if !sess.dirty {
+		return
+	}
+	entry := sess.entry
+	entry.Data = maps.Clone(sess.entry.Data)
+	sess.manager.store.Save(entry)
+	sess.dirty = false
+}
+
+// GetValue returns the value of the key decoded as T.
+func GetValue[T any](sess *Session, key string) (T, error) {
+	var value T
+	err := sess.Get(key, &value)
+	return value, err
+}
+
+// SetValue stores the value for the key.
+func SetValue[T any](sess *Session, key string, value T) error {
+	return sess.Set(key, value)
+}
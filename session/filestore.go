@@ -0,0 +1,149 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/logging"
+)
+
+const fileStoreExtension = ".session"
+
+// FileStore is a SessionStore that keeps each entry in its own file,
+// encrypted with a core.Cypher. Sessions survive restarts and can be
+// shared between instances using a shared directory. The modification
+// time of each file is set to the entry timeout, so expired entries are
+// found without decrypting them (see DeleteExpired).
+type FileStore struct {
+	dir    string
+	cypher core.Cypher
+}
+
+// NewFileStore creates a FileStore that saves the entries in dir. The
+// directory is created if it does not exist.
+func NewFileStore(dir string, cypher core.Cypher) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create session directory '%s': %w", dir, err)
+	}
+	return &FileStore{
+		dir:    dir,
+		cypher: cypher,
+	}, nil
+}
+
+// path returns the file of an entry. Session ids can contain any character,
+// so the name of the file is the hash of the id.
+func (store *FileStore) path(id Id) string {
+	return filepath.Join(store.dir, hashId(id)+fileStoreExtension)
+}
+
+// hashId returns the hex encoded SHA-256 of the id. Stores use it instead
+// of the id, that is a credential, to identify entries.
+func hashId(id Id) string {
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:])
+}
+
+func (store *FileStore) Save(entry Entry) {
+	if err := store.save(entry); err != nil {
+		logging.Logger().Error("cannot save session entry", "error", err)
+	}
+}
+
+func (store *FileStore) save(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("cannot encode session entry: %w", err)
+	}
+	encrypted, err := store.cypher.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt session entry: %w", err)
+	}
+	// Write to a temporary file and rename it, so readers never see
+	// partial entries.
+	tmp, err := os.CreateTemp(store.dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("cannot create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(encrypted); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write session file: %w", err)
+	}
+	if err := os.Chtimes(tmp.Name(), time.Now(), entry.Timeout); err != nil {
+		return fmt.Errorf("cannot set session file expiration: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), store.path(entry.Id)); err != nil {
+		return fmt.Errorf("cannot write session file: %w", err)
+	}
+	return nil
+}
+
+func (store *FileStore) Get(id Id) (Entry, error) {
+	encrypted, err := os.ReadFile(store.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Entry{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("cannot read session file: %w", err)
+	}
+	data, err := store.cypher.Decrypt(encrypted)
+	if err != nil {
+		return Entry{}, fmt.Errorf("cannot decrypt session entry: %w", err)
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, fmt.Errorf("cannot decode session entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (store *FileStore) Delete(id Id) {
+	err := os.Remove(store.path(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Logger().Error("cannot delete session file", "error", err)
+	}
+}
+
+// DeleteExpired removes the files of the expired entries.
+func (store *FileStore) DeleteExpired() error {
+	files, err := os.ReadDir(store.dir)
+	if err != nil {
+		return fmt.Errorf("cannot read session directory: %w", err)
+	}
+	now := time.Now()
+	var errs []error
+	for _, file := range files {
+		if !file.Type().IsRegular() || !strings.HasSuffix(file.Name(), fileStoreExtension) {
+			continue
+		}
+		info, err := file.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if info.ModTime().After(now) {
+			continue
+		}
+		err = os.Remove(filepath.Join(store.dir, file.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
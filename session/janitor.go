@@ -0,0 +1,56 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	"github.com/deltegui/phx/logging"
+)
+
+// DefaultSweepInterval is the time between sweeps of the expired sessions
+// used by the extensions package.
+const DefaultSweepInterval = 5 * time.Minute
+
+// Janitor removes the expired entries of a store periodically in its own
+// goroutine.
+type Janitor struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewJanitor starts calling DeleteExpired of the sweeper every interval
+// until Stop is called.
+func NewJanitor(sweeper Sweeper, interval time.Duration) *Janitor {
+	janitor := &Janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go janitor.run(sweeper, interval)
+	return janitor
+}
+
+func (janitor *Janitor) run(sweeper Sweeper, interval time.Duration) {
+	defer close(janitor.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := sweeper.DeleteExpired(); err != nil {
+				logging.Logger().Error("cannot delete expired sessions", "error", err)
+			}
+		case <-janitor.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the janitor and waits until the current sweep, if any, ends.
+// It can be called many times.
+func (janitor *Janitor) Stop() {
+	janitor.once.Do(func() {
+		close(janitor.stop)
+	})
+	<-janitor.done
+}
@@ -0,0 +1,145 @@
+package session
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryStoreOptions configures a MemoryStore.
+type MemoryStoreOptions struct {
+	// SweepInterval is the time between sweeps of the expired entries.
+	// Zero disables the sweeping, so expired entries are only removed when
+	// they are read.
+	SweepInterval time.Duration
+
+	// MaxEntries limits the number of stored entries. When the store is
+	// full, the least recently used entry is evicted. Zero means no limit.
+	MaxEntries int
+}
+
+// MemoryStoreStats are the counters of a MemoryStore.
+type MemoryStoreStats struct {
+	// Active and Expired are the number of valid and expired stored entries.
+	Active  int
+	Expired int
+
+	// Swept is the number of expired entries removed by sweeps and Evicted
+	// the number of entries removed because the store was full.
+	Swept   uint64
+	Evicted uint64
+}
+
+// MemoryStore is a SessionStore that keeps the entries in memory. Sessions
+// are lost on restart.
+type MemoryStore struct {
+	opts    MemoryStoreOptions
+	values  map[Id]*list.Element
+	lru     *list.List
+	mutex   sync.Mutex
+	swept   uint64
+	evicted uint64
+	janitor *Janitor
+}
+
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreWithOptions(MemoryStoreOptions{})
+}
+
+// NewMemoryStoreWithOptions creates a MemoryStore. If a SweepInterval is
+// set, a goroutine sweeps the expired entries until Stop is called.
+func NewMemoryStoreWithOptions(opts MemoryStoreOptions) *MemoryStore {
+	store := &MemoryStore{
+		opts:   opts,
+		values: make(map[Id]*list.Element),
+		lru:    list.New(),
+	}
+	if opts.SweepInterval > 0 {
+		store.janitor = NewJanitor(store, opts.SweepInterval)
+	}
+	return store
+}
+
+func (store *MemoryStore) Save(entry Entry) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if element, ok := store.values[entry.Id]; ok {
+		element.Value = entry
+		store.lru.MoveToFront(element)
+		return
+	}
+	store.values[entry.Id] = store.lru.PushFront(entry)
+	for store.opts.MaxEntries > 0 && store.lru.Len() > store.opts.MaxEntries {
+		store.remove(store.lru.Back())
+		store.evicted++
+	}
+}
+
+func (store *MemoryStore) Get(id Id) (Entry, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	element, ok := store.values[id]
+	if !ok {
+		return Entry{}, ErrSessionNotFound
+	}
+	store.lru.MoveToFront(element)
+	return element.Value.(Entry), nil
+}
+
+func (store *MemoryStore) Delete(id Id) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if element, ok := store.values[id]; ok {
+		store.remove(element)
+	}
+}
+
+func (store *MemoryStore) remove(element *list.Element) {
+	entry := store.lru.Remove(element).(Entry)
+	delete(store.values, entry.Id)
+}
+
+// DeleteExpired removes the expired entries.
+func (store *MemoryStore) DeleteExpired() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for element := store.lru.Front(); element != nil; {
+		next := element.Next()
+		if !element.Value.(Entry).IsValid() {
+			store.remove(element)
+			store.swept++
+		}
+		element = next
+	}
+	return nil
+}
+
+func (store *MemoryStore) Stats() MemoryStoreStats {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	stats := MemoryStoreStats{
+		Swept:   store.swept,
+		Evicted: store.evicted,
+	}
+	for element := store.lru.Front(); element != nil; element = element.Next() {
+		if element.Value.(Entry).IsValid() {
+			stats.Active++
+		} else {
+			stats.Expired++
+		}
+	}
+	return stats
+}
+
+// Sweeping reports if the store sweeps its expired entries, because it was
+// created with a SweepInterval.
+func (store *MemoryStore) Sweeping() bool {
+	return store.janitor != nil
+}
+
+// Stop stops sweeping the expired entries. It can be called many times.
+func (store *MemoryStore) Stop() {
+	if store.janitor != nil {
+		store.janitor.Stop()
+	}
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Serializer encodes the values stored in a Session.
+type Serializer interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, dst any) error
+}
+
+// JsonSerializer encodes values using encoding/json. It is the default one.
+type JsonSerializer struct{}
+
+func (JsonSerializer) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JsonSerializer) Unmarshal(data []byte, dst any) error {
+	return json.Unmarshal(data, dst)
+}
+
+// GobSerializer encodes values using encoding/gob. Values stored as
+// interfaces must be registered with gob.Register.
+type GobSerializer struct{}
+
+func (GobSerializer) Marshal(value any) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (GobSerializer) Unmarshal(data []byte, dst any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dst)
+}
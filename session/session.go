@@ -4,13 +4,13 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/phx/cypher"
+	"github.com/deltegui/phx/logging"
 )
 
 type Id string
@@ -26,72 +26,105 @@ type Entry struct {
 	Id      Id
 	User    User
 	Timeout time.Time
+
+	// CreatedAt is the time when the user logged in. It is used to enforce
+	// ManagerOptions.AbsoluteTimeout.
+	CreatedAt time.Time
+
+	// Data holds the encoded values of the session. Use Session to
+	// access them.
+	Data map[string][]byte
 }
 
 func (entry Entry) IsValid() bool {
 	return time.Now().Before(entry.Timeout)
 }
 
+// ErrSessionNotFound is returned by SessionStore.Get when there is no
+// entry for the id. The id is not included, as it is a credential.
+var ErrSessionNotFound = errors.New("session entry not found")
+
 type SessionStore interface {
 	Save(entry Entry)
 	Get(id Id) (Entry, error)
 	Delete(id Id)
 }
 
-type MemoryStore struct {
-	values map[Id]Entry
-	mutex  sync.Mutex
+// Sweeper is implemented by the stores that can remove all their expired
+// entries at once.
+type Sweeper interface {
+	DeleteExpired() error
 }
 
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
-		values: make(map[Id]Entry),
-		mutex:  sync.Mutex{},
-	}
+// SelfSweeper is implemented by the stores that can sweep their expired
+// entries in their own goroutine, like a MemoryStore with SweepInterval.
+type SelfSweeper interface {
+	// Sweeping reports if the store is sweeping its expired entries.
+	Sweeping() bool
+	// Stop stops the sweeping.
+	Stop()
 }
 
-func (store *MemoryStore) Save(entry Entry) {
-	store.mutex.Lock()
-	store.values[entry.Id] = entry
-	store.mutex.Unlock()
-}
+// ManagerOptions configures the lifetime of the sessions and the session
+// cookie.
+type ManagerOptions struct {
+	// IdleTimeout is the time a session is valid since it was created or,
+	// if Sliding is set, since the last request.
+	IdleTimeout time.Duration
 
-func (store *MemoryStore) Get(id Id) (Entry, error) {
-	store.mutex.Lock()
-	log.Println("[MemoryStore] number of sessions", len(store.values))
-	for key := range store.values {
-		log.Println("[MemoryStore] Available id : ", key)
-	}
-	entry, ok := store.values[id]
-	store.mutex.Unlock()
-	if !ok {
-		return Entry{}, fmt.Errorf("no session entry for id '%s'", id)
-	}
-	return entry, nil
-}
+	// Sliding renews the session timeout when the session is used. To
+	// avoid writing to the store on every request, the session is renewed
+	// at most once per minute.
+	Sliding bool
+
+	// AbsoluteTimeout is the maximum lifetime of a session since login,
+	// even if it is renewed. Zero means no limit.
+	AbsoluteTimeout time.Duration
+
+	// Secure only sends the session cookie over HTTPS.
+	Secure bool
 
-func (store *MemoryStore) Delete(id Id) {
-	store.mutex.Lock()
-	delete(store.values, id)
-	store.mutex.Unlock()
+	// SameSite of the session cookie. By default http.SameSiteLaxMode.
+	SameSite http.SameSite
 }
 
 type Manager struct {
-	store           SessionStore
-	hasher          core.Hasher
-	timeoutDuration time.Duration
-	cypher          core.Cypher
+	store      SessionStore
+	hasher     core.Hasher
+	options    ManagerOptions
+	cypher     core.Cypher
+	serializer Serializer
 }
 
 func NewManager(store SessionStore, hasher core.Hasher, duration time.Duration, cypher core.Cypher) *Manager {
+	return NewManagerWithOptions(store, hasher, cypher, ManagerOptions{
+		IdleTimeout: duration,
+	})
+}
+
+func NewManagerWithOptions(store SessionStore, hasher core.Hasher, cypher core.Cypher, options ManagerOptions) *Manager {
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
 	return &Manager{
-		store:           store,
-		hasher:          hasher,
-		timeoutDuration: duration,
-		cypher:          cypher,
+		store:      store,
+		hasher:     hasher,
+		options:    options,
+		cypher:     cypher,
+		serializer: JsonSerializer{},
 	}
 }
 
+// SetSerializer sets the Serializer used to encode the values of the
+// sessions. By default JsonSerializer.
+func (manager *Manager) SetSerializer(serializer Serializer) {
+	manager.serializer = serializer
+}
+
+func (manager *Manager) Options() ManagerOptions {
+	return manager.options
+}
+
 func NewInMemoryManager(hasher core.Hasher, duration time.Duration, cypher core.Cypher) *Manager {
 	return NewManager(
 		NewMemoryStore(),
@@ -101,21 +134,38 @@ func NewInMemoryManager(hasher core.Hasher, duration time.Duration, cypher core.
 }
 
 func (manager *Manager) Add(user User) Entry {
-	id := manager.createSessionId(user)
+	now := time.Now()
 	entry := Entry{
-		Id:      id,
-		User:    user,
-		Timeout: time.Now().Add(manager.timeoutDuration),
+		Id:        manager.createSessionId(user),
+		User:      user,
+		Timeout:   manager.timeout(now, now),
+		CreatedAt: now,
 	}
 	manager.store.Save(entry)
 	return entry
 }
 
+// timeout returns the timeout of a session created at createdAt and used
+// at now.
+func (manager *Manager) timeout(createdAt, now time.Time) time.Time {
+	timeout := now.Add(manager.options.IdleTimeout)
+	if manager.options.AbsoluteTimeout > 0 && !createdAt.IsZero() {
+		if limit := createdAt.Add(manager.options.AbsoluteTimeout); limit.Before(timeout) {
+			return limit
+		}
+	}
+	return timeout
+}
+
+func (manager *Manager) renewThreshold() time.Duration {
+	return min(time.Minute, manager.options.IdleTimeout/2)
+}
+
 func (manager *Manager) createSessionId(user User) Id {
 	const bits int = 32
 	random, err := rand.Prime(rand.Reader, bits)
 	if err != nil {
-		log.Panicln("Error while creating prime number for session id: ", err)
+		logging.Panic("cannot create prime number for session id", err)
 	}
 	now := time.Now().UTC().Format(time.ANSIC)
 	str := fmt.Sprintf("%s-%s-%s-%d", random.String(), now, user.Name, user.Id)
@@ -143,28 +193,70 @@ func (manager *Manager) GetUserIfValid(id Id) (User, error) {
 	return User{}, errors.New("expired session")
 }
 
-const cookieKey string = "phx_session"
+// CookieName is the name of the cookie that holds the session id.
+const CookieName string = "phx_session"
 
+// CreateSessionCookie creates a new session for the user and sets the
+// session cookie. Use Login instead when handling a request, so the
+// previous session is destroyed.
 func (manager *Manager) CreateSessionCookie(w http.ResponseWriter, user User) {
 	entry := manager.Add(user)
-	age := core.OneDayDuration
+	manager.setCookie(w, entry)
+}
+
+// Login creates a new session for the user and sets the session cookie.
+// If the request already has a session, it is destroyed to prevent
+// session fixation. Its values are kept if it belongs to the same user.
+func (manager *Manager) Login(w http.ResponseWriter, req *http.Request, user User) *Session {
+	entry := manager.Add(user)
+	if previous, err := manager.ReadSession(req); err == nil {
+		manager.store.Delete(previous.Id())
+		if previous.User().Id == user.Id {
+			entry.Data = previous.entry.Data
+			manager.store.Save(entry)
+		}
+	}
+	manager.setCookie(w, entry)
+	return newSession(manager, entry)
+}
+
+// Regenerate changes the id of the session and sets the new session
+// cookie. Use it when the privileges of the user change (for example, its
+// role) to prevent session fixation. The values and the creation time of
+// the session are kept.
+func (manager *Manager) Regenerate(w http.ResponseWriter, sess *Session, user User) {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	manager.store.Delete(sess.entry.Id)
+	sess.entry.Id = manager.createSessionId(user)
+	sess.entry.User = user
+	sess.entry.Timeout = manager.timeout(sess.entry.CreatedAt, time.Now())
+	entry := sess.entry
+	entry.Data = maps.Clone(sess.entry.Data)
+	manager.store.Save(entry)
+	sess.dirty = false
+	manager.setCookie(w, entry)
+}
+
+func (manager *Manager) setCookie(w http.ResponseWriter, entry Entry) {
 	encoded, err := cypher.EncodeCookie(manager.cypher, string(entry.Id))
 	if err != nil {
-		log.Println("Cannot encrypt session cookie:", err)
+		logging.Logger().Error("cannot encrypt session cookie", "error", err)
 	}
 	http.SetCookie(w, &http.Cookie{
-		Name:     cookieKey,
+		Name:     CookieName,
 		Value:    encoded,
-		Expires:  time.Now().Add(age),
-		MaxAge:   int(age.Seconds()),
+		Expires:  entry.Timeout,
+		MaxAge:   max(int(time.Until(entry.Timeout).Seconds()), 1),
 		Path:     "/",
-		SameSite: http.SameSiteDefaultMode,
+		Secure:   manager.options.Secure,
+		SameSite: manager.options.SameSite,
 		HttpOnly: true,
 	})
 }
 
 func readSessionId(req *http.Request, cy core.Cypher) (Id, *http.Cookie, error) {
-	cookie, err := req.Cookie(cookieKey)
+	cookie, err := req.Cookie(CookieName)
 	if err != nil {
 		return Id(""), nil, errors.New("no session cookie is present in the request")
 	}
@@ -175,14 +267,13 @@ func readSessionId(req *http.Request, cy core.Cypher) (Id, *http.Cookie, error)
 	return Id(id), cookie, nil
 }
 
+// ReadSessionCookie returns the user of the request's session. Unlike
+// Authenticate, the session is never renewed.
 func (manager *Manager) ReadSessionCookie(req *http.Request) (User, error) {
-	sessionId, cookie, err := readSessionId(req, manager.cypher)
+	sessionId, _, err := readSessionId(req, manager.cypher)
 	if err != nil {
 		return User{}, err
 	}
-	if cookie.Expires.After(time.Now()) {
-		return User{}, errors.New("expired sesison cookie")
-	}
 	user, err := manager.GetUserIfValid(sessionId)
 	if err != nil {
 		return User{}, err
@@ -190,6 +281,48 @@ func (manager *Manager) ReadSessionCookie(req *http.Request) (User, error) {
 	return user, nil
 }
 
+// ReadSession returns the Session of the request's session cookie. An
+// error is returned if there is no valid session. Unlike Authenticate,
+// the session is never renewed.
+func (manager *Manager) ReadSession(req *http.Request) (*Session, error) {
+	sessionId, _, err := readSessionId(req, manager.cypher)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := manager.Get(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.IsValid() {
+		manager.store.Delete(sessionId)
+		return nil, errors.New("expired session")
+	}
+	return newSession(manager, entry), nil
+}
+
+// Authenticate returns the Session of the request's session cookie. If
+// ManagerOptions.Sliding is set, the session timeout is renewed and the
+// session cookie is set again.
+func (manager *Manager) Authenticate(w http.ResponseWriter, req *http.Request) (*Session, error) {
+	sess, err := manager.ReadSession(req)
+	if err != nil {
+		return nil, err
+	}
+	if !manager.options.Sliding {
+		return sess, nil
+	}
+	timeout := manager.timeout(sess.entry.CreatedAt, time.Now())
+	if timeout.Sub(sess.entry.Timeout) < manager.renewThreshold() {
+		return sess, nil
+	}
+	sess.entry.Timeout = timeout
+	entry := sess.entry
+	entry.Data = maps.Clone(sess.entry.Data)
+	manager.store.Save(entry)
+	manager.setCookie(w, entry)
+	return sess, nil
+}
+
 func (manager *Manager) DestroySession(w http.ResponseWriter, req *http.Request) error {
 	session, _, err := readSessionId(req, manager.cypher)
 	if err != nil {
@@ -197,9 +330,13 @@ func (manager *Manager) DestroySession(w http.ResponseWriter, req *http.Request)
 	}
 	manager.store.Delete(session)
 	http.SetCookie(w, &http.Cookie{
-		Name:  cookieKey,
-		Value: "",
-		Path:  "/",
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   manager.options.Secure,
+		SameSite: manager.options.SameSite,
+		HttpOnly: true,
 	})
 	return nil
 }
@@ -0,0 +1,148 @@
+// Package sessiontest provides a conformance suite for session.SessionStore
+// implementations:
+//
+//	func TestMyStore(t *testing.T) {
+//		sessiontest.TestStore(t, func(t *testing.T) session.SessionStore {
+//			return mystore.New(t.TempDir())
+//		})
+//	}
+package sessiontest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/session"
+)
+
+// TestStore runs the conformance suite. newStore must return a new empty
+// store each time it is called. If the store implements session.Sweeper,
+// DeleteExpired is tested too.
+func TestStore(t *testing.T, newStore func(t *testing.T) session.SessionStore) {
+	t.Helper()
+	t.Run("GetSavedEntry", func(t *testing.T) {
+		store := newStore(t)
+		entry := newEntry("$2a$10$some/bcrypt.hash+with=symbols", time.Hour)
+		store.Save(entry)
+		assertEntry(t, store, entry)
+	})
+
+	t.Run("GetMissingEntry", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.Get("missing"); !errors.Is(err, session.ErrSessionNotFound) {
+			t.Errorf("expected session.ErrSessionNotFound getting a missing entry, got %v", err)
+		}
+	})
+
+	t.Run("SaveOverridesEntry", func(t *testing.T) {
+		store := newStore(t)
+		entry := newEntry("override", time.Hour)
+		store.Save(entry)
+		entry.User.Name = "changed"
+		entry.Data = map[string][]byte{"cart": []byte("[]")}
+		entry.Timeout = entry.Timeout.Add(time.Hour)
+		store.Save(entry)
+		assertEntry(t, store, entry)
+	})
+
+	t.Run("DeleteEntry", func(t *testing.T) {
+		store := newStore(t)
+		entry := newEntry("delete", time.Hour)
+		other := newEntry("keep", time.Hour)
+		store.Save(entry)
+		store.Save(other)
+		store.Delete(entry.Id)
+		if _, err := store.Get(entry.Id); !errors.Is(err, session.ErrSessionNotFound) {
+			t.Errorf("expected session.ErrSessionNotFound getting a deleted entry, got %v", err)
+		}
+		assertEntry(t, store, other)
+		store.Delete("missing")
+	})
+
+	t.Run("GetExpiredEntry", func(t *testing.T) {
+		store := newStore(t)
+		entry := newEntry("expired", -time.Hour)
+		store.Save(entry)
+		got, err := store.Get(entry.Id)
+		if err == nil && got.IsValid() {
+			t.Error("expected expired entry to be invalid")
+		}
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		store := newStore(t)
+		const workers = 20
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				entry := newEntry(session.Id(fmt.Sprintf("concurrent-%d", i)), time.Hour)
+				store.Save(entry)
+				if _, err := store.Get(entry.Id); err != nil {
+					t.Errorf("cannot get entry saved concurrently: %s", err)
+				}
+				store.Delete(entry.Id)
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		store := newStore(t)
+		sweeper, ok := store.(session.Sweeper)
+		if !ok {
+			t.Skip("store does not implement session.Sweeper")
+		}
+		expired := newEntry("expired", -time.Hour)
+		valid := newEntry("valid", time.Hour)
+		store.Save(expired)
+		store.Save(valid)
+		if err := sweeper.DeleteExpired(); err != nil {
+			t.Fatalf("cannot delete expired entries: %s", err)
+		}
+		if _, err := store.Get(expired.Id); err == nil {
+			t.Error("expected expired entry to be deleted")
+		}
+		assertEntry(t, store, valid)
+	})
+}
+
+func newEntry(id session.Id, timeout time.Duration) session.Entry {
+	return session.Entry{
+		Id: id,
+		User: session.User{
+			Id:    42,
+			Name:  "phx",
+			Role:  core.RoleAdmin,
+			Image: "phx.png",
+		},
+		Timeout:   time.Now().Add(timeout).Round(time.Millisecond),
+		CreatedAt: time.Now().Round(time.Millisecond),
+		Data: map[string][]byte{
+			"cart":  []byte(`{"items":[1,2,3]}`),
+			"empty": {},
+		},
+	}
+}
+
+func assertEntry(t *testing.T, store session.SessionStore, expected session.Entry) {
+	t.Helper()
+	got, err := store.Get(expected.Id)
+	if err != nil {
+		t.Fatalf("cannot get entry '%s': %s", expected.Id, err)
+	}
+	sameData := maps.EqualFunc(got.Data, expected.Data, func(a, b []byte) bool {
+		return bytes.Equal(a, b)
+	})
+	if got.Id != expected.Id || got.User != expected.User || !got.Timeout.Equal(expected.Timeout) ||
+		!got.CreatedAt.Equal(expected.CreatedAt) || !sameData {
+		t.Errorf("expected entry %+v, got %+v", expected, got)
+	}
+}
@@ -0,0 +1,134 @@
+package session_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeDriver is a database/sql driver that understands the queries of
+// SqlStore, so it can be tested without a database. Each DSN is a
+// different database.
+type fakeDriver struct {
+	mutex     sync.Mutex
+	databases map[string]*fakeDatabase
+}
+
+type fakeDatabase struct {
+	mutex sync.Mutex
+	rows  map[string]fakeRow
+}
+
+type fakeRow struct {
+	data      []byte
+	expiresAt int64
+}
+
+var sqlDriver = &fakeDriver{databases: map[string]*fakeDatabase{}}
+
+func init() {
+	sql.Register("phx-fake", sqlDriver)
+}
+
+func (d *fakeDriver) database(dsn string) *fakeDatabase {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	db, ok := d.databases[dsn]
+	if !ok {
+		db = &fakeDatabase{rows: map[string]fakeRow{}}
+		d.databases[dsn] = db
+	}
+	return db
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return fakeConn{d.database(dsn)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDatabase
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.db, query}, nil
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type fakeStmt struct {
+	db    *fakeDatabase
+	query string
+}
+
+func (s fakeStmt) Close() error {
+	return nil
+}
+
+func (s fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE"):
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.db.rows[args[0].(string)] = fakeRow{data: args[1].([]byte), expiresAt: args[2].(int64)}
+	case strings.HasPrefix(s.query, "DELETE") && strings.Contains(s.query, "expires_at <="):
+		for id, row := range s.db.rows {
+			if row.expiresAt <= args[0].(int64) {
+				delete(s.db.rows, id)
+			}
+		}
+	case strings.HasPrefix(s.query, "DELETE"):
+		delete(s.db.rows, args[0].(string))
+	default:
+		return nil, fmt.Errorf("unexpected query: %s", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT data") {
+		return nil, fmt.Errorf("unexpected query: %s", s.query)
+	}
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	row, ok := s.db.rows[args[0].(string)]
+	if !ok {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{data: [][]byte{row.data}}, nil
+}
+
+type fakeRows struct {
+	data [][]byte
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"data"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.data) {
+		return io.EOF
+	}
+	dest[0] = r.data[r.next]
+	r.next++
+	return nil
+}
@@ -0,0 +1,147 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/deltegui/phx/logging"
+)
+
+// Dialect selects the SQL used by SqlStore.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SqlStore is a SessionStore backed by a database/sql database, so
+// sessions survive restarts and are shared between instances. Register
+// the database driver in your application:
+//
+//	db, err := sql.Open("sqlite", "app.db")
+//	store := session.NewSqlStore(db, session.SQLite, "sessions")
+//	if err := store.CreateSchema(); err != nil {
+//		log.Fatalln(err)
+//	}
+//
+// The table has an index on the expiration, so DeleteExpired is cheap.
+// Session ids are credentials, so the table only keeps their hashes.
+type SqlStore struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+// NewSqlStore creates a SqlStore that uses the table. It panics if the
+// table name is not a valid identifier.
+func NewSqlStore(db *sql.DB, dialect Dialect, table string) *SqlStore {
+	if !tableNameRegexp.MatchString(table) {
+		panic(fmt.Sprintf("invalid session table name '%s'", table))
+	}
+	return &SqlStore{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+	}
+}
+
+// placeholder returns the placeholder of the n-th (starting at 1) query
+// param.
+func (store *SqlStore) placeholder(n int) string {
+	if store.dialect == Postgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// CreateSchema creates the table and the expiration index if they do not
+// exist. The expiration is stored as unix milliseconds.
+func (store *SqlStore) CreateSchema() error {
+	dataType := "BLOB"
+	if store.dialect == Postgres {
+		dataType = "BYTEA"
+	}
+	statements := []string{
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, data %s NOT NULL, expires_at BIGINT NOT NULL)",
+			store.table,
+			dataType),
+		fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS %s_expires_at_idx ON %s (expires_at)",
+			store.table,
+			store.table),
+	}
+	for _, statement := range statements {
+		if _, err := store.db.Exec(statement); err != nil {
+			return fmt.Errorf("cannot create session schema: %w", err)
+		}
+	}
+	return nil
+}
+
+func (store *SqlStore) Save(entry Entry) {
+	if err := store.save(entry); err != nil {
+		logging.Logger().Error("cannot save session entry", "error", err)
+	}
+}
+
+func (store *SqlStore) save(entry Entry) error {
+	id := entry.Id
+	entry.Id = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("cannot encode session entry: %w", err)
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (id, data, expires_at) VALUES (%s, %s, %s) "+
+			"ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at",
+		store.table,
+		store.placeholder(1),
+		store.placeholder(2),
+		store.placeholder(3))
+	if _, err := store.db.Exec(query, hashId(id), data, entry.Timeout.UnixMilli()); err != nil {
+		return fmt.Errorf("cannot save session entry: %w", err)
+	}
+	return nil
+}
+
+func (store *SqlStore) Get(id Id) (Entry, error) {
+	query := fmt.Sprintf("SELECT data FROM %s WHERE id = %s", store.table, store.placeholder(1))
+	var data []byte
+	err := store.db.QueryRow(query, hashId(id)).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("cannot read session entry: %w", err)
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, fmt.Errorf("cannot decode session entry: %w", err)
+	}
+	entry.Id = id
+	return entry, nil
+}
+
+func (store *SqlStore) Delete(id Id) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %s", store.table, store.placeholder(1))
+	if _, err := store.db.Exec(query, hashId(id)); err != nil {
+		logging.Logger().Error("cannot delete session entry", "error", err)
+	}
+}
+
+// DeleteExpired removes the expired entries.
+func (store *SqlStore) DeleteExpired() error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE expires_at <= %s", store.table, store.placeholder(1))
+	if _, err := store.db.Exec(query, time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("cannot delete expired session entries: %w", err)
+	}
+	return nil
+}
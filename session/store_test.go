@@ -0,0 +1,112 @@
+package session_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deltegui/phx/cypher"
+	"github.com/deltegui/phx/session"
+	"github.com/deltegui/phx/session/sessiontest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	sessiontest.TestStore(t, func(t *testing.T) session.SessionStore {
+		store := session.NewMemoryStore()
+		t.Cleanup(store.Stop)
+		return store
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	sessiontest.TestStore(t, func(t *testing.T) session.SessionStore {
+		store, err := session.NewFileStore(t.TempDir(), cypher.New())
+		if err != nil {
+			t.Fatalf("cannot create file store: %s", err)
+		}
+		return store
+	})
+}
+
+// TestSqlStore uses the fake driver of sqldriver_test.go, that understands
+// the queries of SqlStore.
+func TestSqlStore(t *testing.T) {
+	var databases atomic.Int64
+	dialects := map[string]session.Dialect{"SQLite": session.SQLite, "Postgres": session.Postgres}
+	for name, dialect := range dialects {
+		t.Run(name, func(t *testing.T) {
+			sessiontest.TestStore(t, func(t *testing.T) session.SessionStore {
+				db, err := sql.Open("phx-fake", fmt.Sprintf("db%d", databases.Add(1)))
+				if err != nil {
+					t.Fatalf("cannot open database: %s", err)
+				}
+				t.Cleanup(func() { db.Close() })
+				store := session.NewSqlStore(db, dialect, "sessions")
+				if err := store.CreateSchema(); err != nil {
+					t.Fatalf("cannot create session table: %s", err)
+				}
+				return store
+			})
+		})
+	}
+}
+
+func TestSqlStoreHashesIds(t *testing.T) {
+	dsn := "hashes"
+	db, err := sql.Open("phx-fake", dsn)
+	if err != nil {
+		t.Fatalf("cannot open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := session.NewSqlStore(db, session.SQLite, "sessions")
+	id := session.Id("plaintext-session-id")
+	store.Save(session.Entry{Id: id, Timeout: time.Now().Add(time.Hour)})
+	for key, row := range sqlDriver.database(dsn).rows {
+		if strings.Contains(key, string(id)) || strings.Contains(string(row.data), string(id)) {
+			t.Errorf("session id stored in plaintext: key %s, data %s", key, row.data)
+		}
+	}
+	entry, err := store.Get(id)
+	if err != nil || entry.Id != id {
+		t.Errorf("expected entry with id %s, got %+v (%v)", id, entry, err)
+	}
+}
+
+// TestSqlStoreDatabase runs against the database set in PHX_TEST_SQL_DRIVER
+// and PHX_TEST_SQL_DSN. The driver must be registered in the test binary.
+// Set PHX_TEST_SQL_DIALECT to "postgres" to use the Postgres dialect.
+func TestSqlStoreDatabase(t *testing.T) {
+	driver := os.Getenv("PHX_TEST_SQL_DRIVER")
+	dsn := os.Getenv("PHX_TEST_SQL_DSN")
+	if len(driver) == 0 || len(dsn) == 0 {
+		t.Skip("PHX_TEST_SQL_DRIVER and PHX_TEST_SQL_DSN are not set")
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		t.Skipf("SQL driver '%s' is not registered", driver)
+	}
+	dialect := session.SQLite
+	if os.Getenv("PHX_TEST_SQL_DIALECT") == "postgres" {
+		dialect = session.Postgres
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("cannot open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var tables atomic.Int64
+	sessiontest.TestStore(t, func(t *testing.T) session.SessionStore {
+		table := fmt.Sprintf("phx_sessions_test_%d", tables.Add(1))
+		store := session.NewSqlStore(db, dialect, table)
+		if err := store.CreateSchema(); err != nil {
+			t.Fatalf("cannot create session table: %s", err)
+		}
+		t.Cleanup(func() { db.Exec("DROP TABLE " + table) })
+		return store
+	})
+}
@@ -0,0 +1,72 @@
+package phx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/deltegui/phx/core"
+	"github.com/deltegui/phx/logging"
+)
+
+// TypedHandler is a function that receives the decoded request and returns
+// the response that will be sent as JSON.
+type TypedHandler[Req any, Resp any] func(ctx *Context, req Req) (Resp, error)
+
+// Typed adapts a TypedHandler to a Handler. If Req is a struct it is
+// filled and validated using Bind. Otherwise the body is decoded as JSON.
+// The returned response is sent as JSON with status 200. Errors (binding,
+// validation or the ones returned by the handler, like core.UseCaseError)
+// are sent to the ErrorHandler. Mark the route with Route.PreferJson so
+// it always responds to them with JSON:
+//
+//	r.Post("/users", func(create CreateUserCase) phx.Handler {
+//		return phx.Typed(func(ctx *phx.Context, req CreateUserRequest) (UserResponse, error) {
+//			return create(ctx, req)
+//		})
+//	}).PreferJson()
+//
+// Invalid maxsize tags of Req are logged when the handler is built.
+func Typed[Req any, Resp any](handler TypedHandler[Req, Resp]) Handler {
+	// Handlers are built by Router.Validate, so malformed tags are
+	// reported at startup.
+	if err := checkFormType(reflect.TypeFor[Req]()); err != nil {
+		logging.Logger().Error("invalid request type for typed handler", "error", err)
+	}
+	return func(ctx *Context) error {
+		var req Req
+		if err := ctx.bindTyped(&req); err != nil {
+			return err
+		}
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return err
+		}
+		return ctx.JsonOk(resp)
+	}
+}
+
+// FromUseCase exposes a core.UseCase as a Handler using Typed.
+func FromUseCase[Req any, Resp any](useCase core.UseCase[Req, Resp]) Handler {
+	return Typed(func(_ *Context, req Req) (Resp, error) {
+		return useCase(req)
+	})
+}
+
+func (ctx *Context) bindTyped(dst any) error {
+	if reflect.TypeOf(dst).Elem().Kind() == reflect.Struct {
+		return ctx.Bind(dst)
+	}
+	if ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+		return nil
+	}
+	if err := ctx.ParseJson(dst); err != nil && !errors.Is(err, io.EOF) {
+		return HttpError{
+			Status:  http.StatusBadRequest,
+			Message: "malformed JSON body",
+			Err:     err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package phx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/deltegui/phx/files"
+	"github.com/deltegui/phx/validator"
+)
+
+// Upload is a file uploaded using a multipart form. Use it as field type
+// in the structs filled by ParseForm.
+type Upload struct {
+	*multipart.FileHeader
+}
+
+// Bytes reads the whole file.
+func (upload Upload) Bytes() ([]byte, error) {
+	file, err := upload.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open uploaded file '%s': %w", upload.Filename, err)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// DetectContentType returns the MIME type of the file detected using its
+// content, not the type declared by the client.
+func (upload Upload) DetectContentType() (string, error) {
+	return detectContentType(upload.FileHeader)
+}
+
+// Save stores the file in the files.Store and returns its URL.
+func (upload Upload) Save(store files.Store, relativePath string) (string, error) {
+	return store.SaveUpload(upload.FileHeader, relativePath)
+}
+
+const sniffLen = 512
+
+func detectContentType(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("cannot open uploaded file '%s': %w", header.Filename, err)
+	}
+	defer file.Close()
+	buffer := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("cannot read uploaded file '%s': %w", header.Filename, err)
+	}
+	contentType := http.DetectContentType(buffer[:n])
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType, nil
+}
+
+func isFile(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == reflect.TypeOf(multipart.FileHeader{}) || t == reflect.TypeOf(Upload{})
+}
+
+func (b *formBinder) bindFiles(field reflect.Value, name string, tag reflect.StructTag) {
+	headers := b.files[name]
+	if len(headers) == 0 {
+		return
+	}
+	valid := make([]*multipart.FileHeader, 0, len(headers))
+	for _, header := range headers {
+		if b.checkFile(header, name, tag) {
+			valid = append(valid, header)
+		}
+	}
+	if len(valid) == 0 {
+		return
+	}
+	t := field.Type()
+	if t.Kind() != reflect.Slice {
+		field.Set(fileValue(t, valid[0]))
+		return
+	}
+	slice := reflect.MakeSlice(t, 0, len(valid))
+	for _, header := range valid {
+		slice = reflect.Append(slice, fileValue(t.Elem(), header))
+	}
+	field.Set(slice)
+}
+
+func fileValue(t reflect.Type, header *multipart.FileHeader) reflect.Value {
+	switch t {
+	case reflect.TypeOf(Upload{}):
+		return reflect.ValueOf(Upload{header})
+	case reflect.TypeOf(&Upload{}):
+		return reflect.ValueOf(&Upload{header})
+	default:
+		return reflect.ValueOf(header)
+	}
+}
+
+func (b *formBinder) checkFile(header *multipart.FileHeader, name string, tag reflect.StructTag) bool {
+	if maxSize, ok := tag.Lookup("maxsize"); ok {
+		// An invalid size is reported by Router.Validate and Typed, so
+		// the file is just rejected as it cannot be checked.
+		size, err := parseSize(maxSize)
+		if err != nil || header.Size > size {
+			b.addError(name, validator.NewMaxSizeError(name, maxSize))
+			return false
+		}
+	}
+	accept, ok := tag.Lookup("accept")
+	if !ok {
+		return true
+	}
+	contentType, err := detectContentType(header)
+	if err != nil || !acceptsContentType(accept, contentType) {
+		b.addError(name, validator.NewMimeTypeError(name, accept))
+		return false
+	}
+	return true
+}
+
+func acceptsContentType(accept, contentType string) bool {
+	for _, allowed := range strings.Split(accept, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == contentType || allowed == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSize parses sizes like "512", "512B", "10KB", "2MB" or "1GB".
+func parseSize(size string) (int64, error) {
+	units := []struct {
+		suffix string
+		bytes  int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	value := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid maxsize tag value '%s'", size)
+	}
+	return n * multiplier, nil
+}
+
+// checkFormType checks the tags of the file fields of t and its nested
+// types, so malformed tags are reported at startup (by Router.Validate
+// and Typed) instead of while binding requests.
+func checkFormType(t reflect.Type) error {
+	return walkFormType(t, map[reflect.Type]bool{})
+}
+
+func walkFormType(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	var errs []error
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !isFile(field.Type) {
+			errs = append(errs, walkFormType(field.Type, seen))
+			continue
+		}
+		if maxSize, ok := field.Tag.Lookup("maxsize"); ok {
+			if _, err := parseSize(maxSize); err != nil {
+				errs = append(errs, fmt.Errorf("field %s of %s: %w", field.Name, t, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,11 +2,55 @@ package validator
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/deltegui/phx/core"
 	"github.com/deltegui/valtruc"
 )
 
+// InvalidTypeName is the name of the validation errors created when a
+// form value cannot be converted to the type of its field. Use it as
+// localization key.
+const InvalidTypeName string = "invalidType"
+
+// NewInvalidTypeError creates the validation error for a field whose value
+// cannot be converted to the expected type (integer, number, date...).
+func NewInvalidTypeError(field, expected string) core.ValidationError {
+	return CustomValidationError{
+		Param:   expected,
+		Name:    InvalidTypeName,
+		Message: fmt.Sprintf("field '%s' must be a valid %s", field, expected),
+	}
+}
+
+// MaxSizeName is the name of the validation errors created when an
+// uploaded file is bigger than the allowed size.
+const MaxSizeName string = "maxSize"
+
+// NewMaxSizeError creates the validation error for an uploaded file that
+// is bigger than maxSize.
+func NewMaxSizeError(field, maxSize string) core.ValidationError {
+	return CustomValidationError{
+		Param:   maxSize,
+		Name:    MaxSizeName,
+		Message: fmt.Sprintf("file '%s' must not be bigger than %s", field, maxSize),
+	}
+}
+
+// MimeTypeName is the name of the validation errors created when the
+// type of an uploaded file is not allowed.
+const MimeTypeName string = "mimeType"
+
+// NewMimeTypeError creates the validation error for an uploaded file whose
+// detected type is not one of the accepted ones.
+func NewMimeTypeError(field, accepted string) core.ValidationError {
+	return CustomValidationError{
+		Param:   accepted,
+		Name:    MimeTypeName,
+		Message: fmt.Sprintf("file '%s' must be of type %s", field, accepted),
+	}
+}
+
 type CustomValidationError struct {
 	Param   string
 	Name    string